@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -228,12 +229,56 @@ func parseConfig(reader LineReader, context *parserContext) error {
 				context.attrs[submatch[1]] = submatch[2]
 			}
 		} else {
-			return errors.New(fmt.Sprintf("Parse error in %s at line %s", reader.Filename(), reader.LineNumber()))
+			return errors.New(fmt.Sprintf("Parse error in %s at line %d", reader.Filename(), reader.LineNumber()))
 		}
 	}
 	return nil
 }
 
+// Flatten returns the attributes of the element with its nested sections
+// folded in, so that plugins keep receiving a flat map. The attributes of the
+// i-th <name> section are stored as "name.i.attr" and its arguments as "name.i".
+func (elem *ConfigElement) Flatten() map[string]string {
+	attrs := make(map[string]string)
+	for k, v := range elem.Attrs {
+		attrs[k] = v
+	}
+
+	index := make(map[string]int)
+	for _, sub := range elem.Elems {
+		prefix := sub.Name + "." + strconv.Itoa(index[sub.Name])
+		index[sub.Name]++
+
+		attrs[prefix] = sub.Args
+		for k, v := range sub.Flatten() {
+			attrs[prefix+"."+k] = v
+		}
+	}
+
+	return attrs
+}
+
+// Sections returns the nested <name> sections of a flattened config in the
+// order they appeared in the configuration file.
+func Sections(cf map[string]string, name string) []map[string]string {
+	sections := make([]map[string]string, 0)
+	for i := 0; ; i++ {
+		prefix := name + "." + strconv.Itoa(i)
+		if _, ok := cf[prefix]; !ok {
+			break
+		}
+
+		section := make(map[string]string)
+		for k, v := range cf {
+			if strings.HasPrefix(k, prefix+".") {
+				section[k[len(prefix)+1:]] = v
+			}
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
 func ParseConfig(opener Opener, filename string) (*Config, error) {
 	context := makeParserContext("(root)", "", opener)
 	reader, err := NewLineReader(nil, filename)
@@ -57,3 +57,45 @@ func Test_ReadConf(t *testing.T) {
 	})
 	os.Remove(testFile)
 }
+
+func Test_FlattenSections(t *testing.T) {
+	content := `<match app.**>
+  type rewrite_tag_filter
+  <rule>
+    key level
+    pattern ^ERROR$
+    tag alert.${tag}
+  </rule>
+  <rule>
+    key level
+    pattern ^WARN$
+    tag warn.${tag}
+  </rule>
+</match>`
+
+	testFile := "/tmp/test.file"
+	os.Remove(testFile)
+
+	Convey("Nested sections are folded into the plugin config", t, func() {
+		f, err := os.OpenFile(testFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		So(err, ShouldEqual, nil)
+		_, err = f.WriteString(content)
+		So(err, ShouldEqual, nil)
+		f.Close()
+
+		config, err := ParseConfig(nil, testFile)
+		So(err, ShouldEqual, nil)
+		So(len(config.Root.Elems), ShouldEqual, 1)
+
+		cf := config.Root.Elems[0].Flatten()
+		So(cf["type"], ShouldEqual, "rewrite_tag_filter")
+		So(cf["rule.1.pattern"], ShouldEqual, "^WARN$")
+
+		rules := Sections(cf, "rule")
+		So(len(rules), ShouldEqual, 2)
+		So(rules[0]["tag"], ShouldEqual, "alert.${tag}")
+		So(rules[1]["tag"], ShouldEqual, "warn.${tag}")
+		So(len(Sections(cf, "parse")), ShouldEqual, 0)
+	})
+	os.Remove(testFile)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/ugorji/go/codec"
+	"reflect"
+	"time"
+)
+
+// EventTime is the event time in nanoseconds since the Unix epoch. It is
+// encoded as the Fluentd EventTime msgpack extension: type 0 holding the
+// seconds and the nanoseconds as two big-endian uint32.
+type EventTime int64
+
+const eventTimeExtType = 0
+
+type eventTimeExt struct{}
+
+func (eventTimeExt) WriteExt(v interface{}) []byte {
+	var t EventTime
+	switch v := v.(type) {
+	case EventTime:
+		t = v
+	case *EventTime:
+		t = *v
+	}
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(int64(t)/int64(time.Second)))
+	binary.BigEndian.PutUint32(b[4:], uint32(int64(t)%int64(time.Second)))
+	return b
+}
+
+func (eventTimeExt) ReadExt(dst interface{}, src []byte) {
+	if len(src) != 8 {
+		return
+	}
+
+	sec := int64(binary.BigEndian.Uint32(src))
+	nsec := int64(binary.BigEndian.Uint32(src[4:]))
+	*dst.(*EventTime) = EventTime(sec*int64(time.Second) + nsec)
+}
+
+// newForwardCodec returns a msgpack handle speaking the forward protocol,
+// which encodes strings with the str type and knows about EventTime.
+func newForwardCodec() *codec.MsgpackHandle {
+	_codec := codec.MsgpackHandle{}
+	_codec.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	_codec.RawToString = true
+	_codec.WriteExt = true
+	_codec.SetBytesExt(reflect.TypeOf(EventTime(0)), eventTimeExtType, eventTimeExt{})
+
+	return &_codec
+}
+
+// toTimestamp converts the time of a forward protocol entry, either an
+// EventTime or integer seconds, to nanoseconds.
+func toTimestamp(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case EventTime:
+		return int64(v), true
+	case int64:
+		return v * int64(time.Second), true
+	case uint64:
+		return int64(v) * int64(time.Second), true
+	case float64:
+		return int64(v * float64(time.Second)), true
+	}
+	return 0, false
+}
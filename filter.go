@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+)
+
+var filter_plugins = make(map[string]func() interface{})
+
+func RegisterFilter(name string, filter func() interface{}) {
+	if filter == nil {
+		log.Fatalln("filter: Register filter is nil")
+	}
+
+	if _, ok := filter_plugins[name]; ok {
+		log.Fatalln("filter: Register called twice for filter " + name)
+	}
+
+	filter_plugins[name] = filter
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dedupEntry struct {
+	hash [sha1.Size]byte
+	seen int64
+}
+
+// dedupCache is a bounded LRU of record hashes and the time they were last
+// seen.
+type dedupCache struct {
+	size    int
+	entries map[[sha1.Size]byte]*list.Element
+	lru     *list.List
+}
+
+func newDedupCache(size int) *dedupCache {
+	return &dedupCache{
+		size:    size,
+		entries: make(map[[sha1.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Seen reports whether hash was seen after since, and records it at now in
+// both cases, so that a hash seen again and again stays in the window.
+func (self *dedupCache) Seen(hash [sha1.Size]byte, since, now int64) bool {
+	if e, ok := self.entries[hash]; ok {
+		entry := e.Value.(*dedupEntry)
+		if entry.seen > since {
+			entry.seen = now
+			self.lru.MoveToFront(e)
+			return true
+		}
+		self.lru.Remove(e)
+		delete(self.entries, hash)
+	}
+
+	self.entries[hash] = self.lru.PushFront(&dedupEntry{hash, now})
+	for self.lru.Len() > self.size {
+		e := self.lru.Back()
+		self.lru.Remove(e)
+		delete(self.entries, e.Value.(*dedupEntry).hash)
+	}
+	return false
+}
+
+// Save writes the entries seen after since to path, least recently used
+// first, and atomically replaces the previous file.
+func (self *dedupCache) Save(path string, since int64) error {
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for e := self.lru.Back(); e != nil; e = e.Prev() {
+		entry := e.Value.(*dedupEntry)
+		if entry.seen > since {
+			fmt.Fprintf(w, "%s %d\n", hex.EncodeToString(entry.hash[:]), entry.seen)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	f.Sync()
+	f.Close()
+
+	return os.Rename(tmpPath, path)
+}
+
+// Load restores the entries seen after since from path.
+func (self *dedupCache) Load(path string, since int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		var hash [sha1.Size]byte
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != len(hash) {
+			continue
+		}
+		copy(hash[:], b)
+
+		seen, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || seen <= since {
+			continue
+		}
+
+		self.Seen(hash, since, seen)
+	}
+
+	return scanner.Err()
+}
+
+type filterDedup struct {
+	keys          []string
+	window        int
+	cache_size    int
+	persist_path  string
+	sync_interval int
+
+	cache *dedupCache
+}
+
+func (self *filterDedup) Init(cf map[string]string) error {
+	self.window = 600
+	self.cache_size = 100000
+	self.sync_interval = 10
+
+	value := cf["key"]
+	if len(value) > 0 {
+		for _, key := range strings.Split(value, ",") {
+			self.keys = append(self.keys, strings.TrimSpace(key))
+		}
+	}
+
+	value = cf["window"]
+	if len(value) > 0 {
+		window, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if window <= 0 {
+			return fmt.Errorf("invalid window %d", window)
+		}
+		self.window = window
+	}
+
+	value = cf["cache_size"]
+	if len(value) > 0 {
+		cache_size, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if cache_size <= 0 {
+			return fmt.Errorf("invalid cache_size %d", cache_size)
+		}
+		self.cache_size = cache_size
+	}
+
+	value = cf["sync_interval"]
+	if len(value) > 0 {
+		sync_interval, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if sync_interval <= 0 {
+			return fmt.Errorf("invalid sync_interval %d", sync_interval)
+		}
+		self.sync_interval = sync_interval
+	}
+
+	self.cache = newDedupCache(self.cache_size)
+
+	value = cf["persist_path"]
+	if len(value) > 0 {
+		self.persist_path = value
+
+		err := self.cache.Load(self.persist_path, self.since(time.Now()))
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("dedup: failed to load", self.persist_path, "err:", err)
+		}
+	}
+
+	return nil
+}
+
+func (self *filterDedup) Run(runner FilterRunner) error {
+	tick := time.NewTicker(time.Second * time.Duration(self.sync_interval))
+	if len(self.persist_path) == 0 {
+		tick.Stop()
+	}
+
+	dirty := false
+
+	for {
+		select {
+		case <-tick.C:
+			{
+				if dirty {
+					err := self.cache.Save(self.persist_path, self.since(time.Now()))
+					if err != nil {
+						log.Println("dedup: failed to save", self.persist_path, "err:", err)
+						continue
+					}
+					dirty = false
+				}
+			}
+		case pack := <-runner.InChan():
+			{
+				hash, err := self.hash(&pack.Msg)
+				if err != nil {
+					log.Println("dedup: failed to hash record, tag=", pack.Msg.Tag, "err:", err)
+					runner.RouterChan() <- pack
+					continue
+				}
+
+				now := time.Now()
+				if self.cache.Seen(hash, self.since(now), now.UnixNano()) {
+					pack.Recycle()
+					continue
+				}
+
+				dirty = true
+				runner.RouterChan() <- pack
+			}
+		}
+	}
+}
+
+func (self *filterDedup) since(now time.Time) int64 {
+	return now.Add(-time.Duration(self.window) * time.Second).UnixNano()
+}
+
+// hash digests the tag and the configured keys of the record, or the whole
+// record when no key is configured. encoding/json sorts map keys, which
+// makes the encoding stable.
+func (self *filterDedup) hash(msg *Message) ([sha1.Size]byte, error) {
+	var v interface{} = msg.Data
+	if len(self.keys) > 0 {
+		values := make([]interface{}, len(self.keys))
+		for i, k := range self.keys {
+			values[i] = msg.Data[k]
+		}
+		v = values
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return [sha1.Size]byte{}, err
+	}
+
+	return sha1.Sum(append([]byte(msg.Tag+"\x00"), b...)), nil
+}
+
+func init() {
+	RegisterFilter("dedup", func() interface{} {
+		return new(filterDedup)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDedupFilter(t *testing.T) {
+	persist := "/tmp/test.dedup"
+	os.Remove(persist)
+
+	cf := map[string]string{
+		"key":          "id,host",
+		"window":       "60",
+		"persist_path": persist,
+	}
+	dedup := new(filterDedup)
+
+	Convey("Init dedup plugin", t, func() {
+		err := dedup.Init(cf)
+		So(err, ShouldEqual, nil)
+	})
+
+	in := make(chan *PipelinePack, 1)
+	router := make(chan *PipelinePack, 1)
+	fRunner := NewFilterRunner(in, nil, router)
+	go dedup.Run(fRunner)
+
+	send := func(id int, host string) (*PipelinePack, chan *PipelinePack) {
+		recycle := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(recycle)
+		pack.Msg.Tag = "test.dedup"
+		pack.Msg.Data["id"] = id
+		pack.Msg.Data["host"] = host
+		pack.Msg.Data["other"] = time.Now().UnixNano()
+		in <- pack
+		return pack, recycle
+	}
+
+	Convey("Duplicates within the window are dropped", t, func() {
+		one, _ := send(1, "a")
+		So(<-router, ShouldEqual, one)
+
+		_, recycle := send(1, "a")
+		<-recycle
+		So(len(router), ShouldEqual, 0)
+
+		two, _ := send(2, "a")
+		So(<-router, ShouldEqual, two)
+	})
+
+	Convey("Seen hashes survive a restart", t, func() {
+		err := dedup.cache.Save(persist, dedup.since(time.Now()))
+		So(err, ShouldEqual, nil)
+
+		restarted := new(filterDedup)
+		err = restarted.Init(cf)
+		So(err, ShouldEqual, nil)
+
+		msg := Message{Tag: "test.dedup", Data: map[string]interface{}{"id": 2, "host": "a"}}
+		hash, _ := restarted.hash(&msg)
+		now := time.Now()
+		So(restarted.cache.Seen(hash, restarted.since(now), now.UnixNano()), ShouldEqual, true)
+	})
+
+	Convey("The cache is bounded", t, func() {
+		cache := newDedupCache(2)
+		now := time.Now().UnixNano()
+		cache.Seen([20]byte{1}, 0, now)
+		cache.Seen([20]byte{2}, 0, now)
+		cache.Seen([20]byte{1}, 0, now)
+		cache.Seen([20]byte{3}, 0, now)
+		So(cache.lru.Len(), ShouldEqual, 2)
+		So(cache.Seen([20]byte{1}, 0, now), ShouldEqual, true)
+		So(cache.Seen([20]byte{2}, 0, now), ShouldEqual, false)
+	})
+
+	Convey("The window slides on each duplicate", t, func() {
+		cache := newDedupCache(10)
+		second := int64(time.Second)
+		So(cache.Seen([20]byte{1}, 0, 10*second), ShouldEqual, false)
+		So(cache.Seen([20]byte{1}, 5*second, 14*second), ShouldEqual, true)
+		So(cache.Seen([20]byte{1}, 12*second, 22*second), ShouldEqual, true)
+		So(cache.Seen([20]byte{1}, 22*second, 32*second), ShouldEqual, false)
+	})
+
+	Convey("The sync interval, window and cache size must be positive", t, func() {
+		So(new(filterDedup).Init(map[string]string{"sync_interval": "0"}), ShouldNotEqual, nil)
+		So(new(filterDedup).Init(map[string]string{"window": "0"}), ShouldNotEqual, nil)
+		So(new(filterDedup).Init(map[string]string{"cache_size": "-1"}), ShouldNotEqual, nil)
+	})
+
+	os.Remove(persist)
+}
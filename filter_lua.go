@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Return codes of the script function, as in fluent-bit's lua filter.
+const (
+	luaDrop     = -1
+	luaKeep     = 0
+	luaModified = 1
+	luaDataOnly = 2
+)
+
+type filterLua struct {
+	script  string
+	code    string
+	call    string
+	timeout time.Duration
+
+	state *lua.LState
+	fn    lua.LValue
+}
+
+func (self *filterLua) Init(cf map[string]string) error {
+	self.call = "filter"
+	self.timeout = 100 * time.Millisecond
+
+	value := cf["script"]
+	if len(value) > 0 {
+		self.script = value
+	}
+
+	value = cf["code"]
+	if len(value) > 0 {
+		self.code = value
+	}
+
+	if len(self.script) == 0 && len(self.code) == 0 {
+		return errors.New("script or code is required")
+	}
+
+	value = cf["call"]
+	if len(value) > 0 {
+		self.call = value
+	}
+
+	value = cf["timeout"]
+	if len(value) > 0 {
+		timeout, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.timeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	self.state = lua.NewState()
+
+	var err error
+	if len(self.script) > 0 {
+		err = self.state.DoFile(self.script)
+	} else {
+		err = self.state.DoString(self.code)
+	}
+	if err != nil {
+		return err
+	}
+
+	self.fn = self.state.GetGlobal(self.call)
+	if self.fn.Type() != lua.LTFunction {
+		return fmt.Errorf("function %s is not defined by the script", self.call)
+	}
+
+	return nil
+}
+
+func (self *filterLua) Run(runner FilterRunner) error {
+	defer self.state.Close()
+
+	for {
+		pack := <-runner.InChan()
+
+		records, timestamp, err := self.filter(&pack.Msg)
+		if err != nil {
+			log.Println("lua filter failed, tag=", pack.Msg.Tag, "err:", err)
+			pack.Recycle()
+			continue
+		}
+
+		if records == nil {
+			runner.RouterChan() <- pack
+			continue
+		}
+
+		if len(records) == 0 {
+			pack.Recycle()
+			continue
+		}
+
+		// pack may be recycled once routed, the events after it are routed
+		// like it
+		tag, index, label, rewrites := pack.Msg.Tag, pack.FilterIndex, pack.Label, pack.Rewrites
+		for i, record := range records {
+			npack := pack
+			if i > 0 {
+				npack = <-runner.RecycleChan()
+				npack.Msg.Tag = tag
+				npack.FilterIndex = index
+				npack.Label = label
+				npack.Rewrites = rewrites
+			}
+			npack.Msg.Timestamp = timestamp
+			npack.Msg.Data = record
+			runner.RouterChan() <- npack
+		}
+	}
+}
+
+// filter calls the script function with tag, timestamp and record. It
+// returns nil records when the event is kept unchanged and an empty slice
+// when the event is dropped.
+func (self *filterLua) filter(msg *Message) ([]map[string]interface{}, int64, error) {
+	L := self.state
+
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	err := L.CallByParam(lua.P{Fn: self.fn, NRet: 3, Protect: true},
+		lua.LString(msg.Tag), lua.LNumber(float64(msg.Timestamp)/float64(time.Second)), toLuaValue(L, msg.Data))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	code, timestamp, result := L.Get(-3), L.Get(-2), L.Get(-1)
+	L.Pop(3)
+
+	n, ok := code.(lua.LNumber)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected return code %v", code)
+	}
+
+	switch int(n) {
+	case luaDrop:
+		return []map[string]interface{}{}, 0, nil
+	case luaKeep:
+		return nil, msg.Timestamp, nil
+	case luaModified, luaDataOnly:
+	default:
+		return nil, 0, fmt.Errorf("unexpected return code %v", code)
+	}
+
+	ts := msg.Timestamp
+	if int(n) == luaModified {
+		t, ok := timestamp.(lua.LNumber)
+		if !ok {
+			return nil, 0, fmt.Errorf("unexpected timestamp %v", timestamp)
+		}
+		ts = int64(float64(t) * float64(time.Second))
+	}
+
+	tb, ok := result.(*lua.LTable)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected record %v", result)
+	}
+
+	// A sequence of tables emits one event per record.
+	if tb.MaxN() > 0 {
+		records := make([]map[string]interface{}, 0, tb.MaxN())
+		for i := 1; i <= tb.MaxN(); i++ {
+			record, ok := fromLuaValue(tb.RawGetInt(i)).(map[string]interface{})
+			if !ok {
+				return nil, 0, fmt.Errorf("unexpected record %v", tb.RawGetInt(i))
+			}
+			records = append(records, record)
+		}
+		return records, ts, nil
+	}
+
+	record, ok := fromLuaValue(tb).(map[string]interface{})
+	if !ok {
+		record = make(map[string]interface{})
+	}
+	return []map[string]interface{}{record}, ts, nil
+}
+
+func toLuaValue(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case []interface{}:
+		tb := L.NewTable()
+		for _, e := range v {
+			tb.Append(toLuaValue(L, e))
+		}
+		return tb
+	case map[string]interface{}:
+		tb := L.NewTable()
+		for k, e := range v {
+			tb.RawSetString(k, toLuaValue(L, e))
+		}
+		return tb
+	case map[interface{}]interface{}:
+		tb := L.NewTable()
+		for k, e := range v {
+			tb.RawSetString(fmt.Sprint(k), toLuaValue(L, e))
+		}
+		return tb
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+func fromLuaValue(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case *lua.LTable:
+		if v.MaxN() > 0 {
+			array := make([]interface{}, 0, v.MaxN())
+			for i := 1; i <= v.MaxN(); i++ {
+				array = append(array, fromLuaValue(v.RawGetInt(i)))
+			}
+			return array
+		}
+		m := make(map[string]interface{})
+		v.ForEach(func(key, value lua.LValue) {
+			m[key.String()] = fromLuaValue(value)
+		})
+		return m
+	default:
+		return nil
+	}
+}
+
+func init() {
+	RegisterFilter("lua", func() interface{} {
+		return new(filterLua)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestLuaFilter(t *testing.T) {
+	cf := map[string]string{
+		"tag": "test.**",
+		"code": `
+function filter(tag, timestamp, record)
+  if record["level"] == "DEBUG" then
+    return -1, 0, 0
+  end
+  if record["split"] then
+    return 2, 0, {{part = 1}, {part = 2}}
+  end
+  if record["loop"] then
+    while true do end
+  end
+  record["tag"] = tag
+  return 1, timestamp + 1, record
+end`,
+		"timeout": "50",
+	}
+	filter := new(filterLua)
+
+	Convey("Init lua filter plugin", t, func() {
+		err := filter.Init(cf)
+		So(err, ShouldEqual, nil)
+	})
+
+	in := make(chan *PipelinePack, 1)
+	router := make(chan *PipelinePack, 2)
+	fRunner := NewFilterRunner(in, NewPipelinePackPool(1), router)
+	go filter.Run(fRunner)
+
+	Convey("Records are modified by the script", t, func() {
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		pack.Msg.Tag = "test.one"
+		pack.Msg.Timestamp = 10 * int64(time.Second)
+		pack.Msg.Data["count"] = int64(3)
+		in <- pack
+
+		res := <-router
+		So(res.Msg.Timestamp, ShouldEqual, 11*int64(time.Second))
+		So(res.Msg.Data["tag"], ShouldEqual, "test.one")
+		So(res.Msg.Data["count"], ShouldEqual, 3)
+	})
+
+	Convey("Records are dropped by the script", t, func() {
+		recycle := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(recycle)
+		pack.Msg.Data["level"] = "DEBUG"
+		in <- pack
+
+		<-recycle
+		So(len(router), ShouldEqual, 0)
+	})
+
+	Convey("One record emits several events", t, func() {
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		pack.Msg.Tag = "test.split"
+		pack.FilterIndex = 1
+		pack.Msg.Data["split"] = true
+		in <- pack
+
+		one, two := <-router, <-router
+		So(one.Msg.Data["part"], ShouldEqual, 1)
+		So(two.Msg.Data["part"], ShouldEqual, 2)
+		So(two.Msg.Tag, ShouldEqual, "test.split")
+		So(two.FilterIndex, ShouldEqual, 1)
+	})
+
+	Convey("The events emitted after a routed pack do not read it", t, func() {
+		filter := new(filterLua)
+		So(filter.Init(cf), ShouldEqual, nil)
+
+		// the pool is empty until the first event is recycled into it
+		pool := make(chan *PipelinePack, 1)
+		in := make(chan *PipelinePack)
+		router := make(chan *PipelinePack)
+		go filter.Run(NewFilterRunner(in, pool, router))
+
+		pack := NewPipelinePack(pool)
+		pack.Msg.Tag = "test.split"
+		pack.FilterIndex = 1
+		pack.Msg.Data["split"] = true
+		in <- pack
+
+		for i := 1; i <= 2; i++ {
+			res := <-router
+			So(res.Msg.Data["part"], ShouldEqual, i)
+			So(res.Msg.Tag, ShouldEqual, "test.split")
+			So(res.FilterIndex, ShouldEqual, 1)
+			res.Msg.Tag = ""
+			res.Recycle()
+		}
+	})
+
+	Convey("Scripts exceeding the time budget are interrupted", t, func() {
+		recycle := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(recycle)
+		pack.Msg.Data["loop"] = true
+		in <- pack
+
+		<-recycle
+		So(len(router), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+type filterParser struct {
+	key_name                     string
+	reserve_data                 bool
+	inject_key_prefix            string
+	hash_value_field             string
+	emit_invalid_record_to_error bool
+
+	parser *RecordParser
+}
+
+func (self *filterParser) Init(cf map[string]string) error {
+	self.emit_invalid_record_to_error = true
+
+	value := cf["key_name"]
+	if len(value) > 0 {
+		self.key_name = value
+	} else {
+		return errors.New("key_name is required")
+	}
+
+	parser, err := NewRecordParser(ParseSection(cf))
+	if err != nil {
+		return err
+	}
+	self.parser = parser
+
+	value = cf["reserve_data"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.reserve_data = true
+		}
+	}
+
+	value = cf["inject_key_prefix"]
+	if len(value) > 0 {
+		self.inject_key_prefix = value
+	}
+
+	value = cf["hash_value_field"]
+	if len(value) > 0 {
+		self.hash_value_field = value
+	}
+
+	value = cf["emit_invalid_record_to_error"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.emit_invalid_record_to_error = false
+		}
+	}
+
+	return nil
+}
+
+func (self *filterParser) Run(runner FilterRunner) error {
+	for {
+		pack := <-runner.InChan()
+
+		err := self.filter(&pack.Msg)
+		if _, ok := err.(*TypeError); ok {
+			// the record is parsed, but for the fields not converted
+			if self.emit_invalid_record_to_error {
+				log.Println("parser filter:", err, "tag=", pack.Msg.Tag)
+				pack.Label = ErrorLabel
+			}
+		} else if err != nil {
+			if self.emit_invalid_record_to_error {
+				log.Println("parser filter:", err, "tag=", pack.Msg.Tag)
+			}
+
+			switch {
+			case self.reserve_data && self.emit_invalid_record_to_error:
+				// the original record goes on, a copy goes to @ERROR
+				self.emitError(runner, pack)
+			case self.emit_invalid_record_to_error:
+				pack.Label = ErrorLabel
+			case !self.reserve_data:
+				pack.Recycle()
+				continue
+			}
+		}
+
+		runner.RouterChan() <- pack
+	}
+}
+
+// emitError emits a copy of the event of pack to the @ERROR label.
+func (self *filterParser) emitError(runner FilterRunner, pack *PipelinePack) {
+	npack := <-runner.RecycleChan()
+	npack.Msg.Tag = pack.Msg.Tag
+	npack.Msg.Timestamp = pack.Msg.Timestamp
+	for k, v := range pack.Msg.Data {
+		npack.Msg.Data[k] = v
+	}
+	npack.FilterIndex = pack.FilterIndex
+	npack.Label = ErrorLabel
+	runner.RouterChan() <- npack
+}
+
+// filter parses the key_name field and merges the result into msg. The
+// message is left untouched when the field can not be parsed. The fields
+// which can not be converted to their type are merged as they are, and a
+// *TypeError is returned.
+func (self *filterParser) filter(msg *Message) error {
+	value, ok := msg.Data[self.key_name]
+	if !ok {
+		return fmt.Errorf("%s does not exist", self.key_name)
+	}
+
+	var text []byte
+	switch value := value.(type) {
+	case string:
+		text = []byte(value)
+	case []byte:
+		text = value
+	default:
+		return fmt.Errorf("%s is not a string", self.key_name)
+	}
+
+	result := Message{Timestamp: msg.Timestamp}
+	err := self.parser.Parse(text, &result)
+	if _, ok := err.(*TypeError); !ok && err != nil {
+		return err
+	}
+	msg.Timestamp = result.Timestamp
+	parsed := result.Data
+
+	if len(self.inject_key_prefix) > 0 {
+		prefixed := make(map[string]interface{}, len(parsed))
+		for k, v := range parsed {
+			prefixed[self.inject_key_prefix+k] = v
+		}
+		parsed = prefixed
+	}
+
+	if len(self.hash_value_field) > 0 {
+		parsed = map[string]interface{}{self.hash_value_field: parsed}
+	}
+
+	if !self.reserve_data {
+		msg.Data = parsed
+		return err
+	}
+
+	for k, v := range parsed {
+		msg.Data[k] = v
+	}
+	return err
+}
+
+func init() {
+	RegisterFilter("parser", func() interface{} {
+		return new(filterParser)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestParserFilter(t *testing.T) {
+	Convey("Parse a json field and keep the original record", t, func() {
+		parser := new(filterParser)
+		err := parser.Init(map[string]string{
+			"key_name":          "message",
+			"format":            "json",
+			"reserve_data":      "on",
+			"inject_key_prefix": "msg.",
+		})
+		So(err, ShouldEqual, nil)
+
+		msg := Message{Data: map[string]interface{}{
+			"message": `{"user":"root","time":1420070400}`,
+			"host":    "server1",
+		}}
+		err = parser.filter(&msg)
+		So(err, ShouldEqual, nil)
+		So(msg.Timestamp, ShouldEqual, 1420070400*int64(time.Second))
+		So(msg.Data["msg.user"], ShouldEqual, "root")
+		So(msg.Data["host"], ShouldEqual, "server1")
+		So(msg.Data["message"], ShouldNotEqual, nil)
+	})
+
+	Convey("Parse a field with a regexp into a nested field", t, func() {
+		parser := new(filterParser)
+		err := parser.Init(map[string]string{
+			"key_name":         "message",
+			"format":           "/^(?<level>[A-Z]+) (?<text>.*)$/",
+			"hash_value_field": "parsed",
+		})
+		So(err, ShouldEqual, nil)
+
+		msg := Message{Data: map[string]interface{}{
+			"message": "ERROR disk full",
+			"host":    "server1",
+		}}
+		err = parser.filter(&msg)
+		So(err, ShouldEqual, nil)
+		So(msg.Data["host"], ShouldEqual, nil)
+		parsed := msg.Data["parsed"].(map[string]interface{})
+		So(parsed["level"], ShouldEqual, "ERROR")
+		So(parsed["text"], ShouldEqual, "disk full")
+	})
+
+	Convey("Invalid records are emitted to the error label", t, func() {
+		parser := new(filterParser)
+		err := parser.Init(map[string]string{
+			"key_name": "message",
+			"format":   "json",
+		})
+		So(err, ShouldEqual, nil)
+
+		in := make(chan *PipelinePack, 1)
+		router := make(chan *PipelinePack, 1)
+		go parser.Run(NewFilterRunner(in, nil, router))
+
+		pack := NewPipelinePack(nil)
+		pack.Msg.Data["message"] = "not json"
+		in <- pack
+
+		res := <-router
+		So(res.Label, ShouldEqual, ErrorLabel)
+		So(res.Msg.Data["message"], ShouldEqual, "not json")
+	})
+	Convey("With reserve_data, invalid records go on and a copy is emitted to the error label", t, func() {
+		parser := new(filterParser)
+		err := parser.Init(map[string]string{
+			"key_name":     "message",
+			"format":       "json",
+			"reserve_data": "on",
+		})
+		So(err, ShouldEqual, nil)
+
+		in := make(chan *PipelinePack, 1)
+		router := make(chan *PipelinePack, 2)
+		go parser.Run(NewFilterRunner(in, NewPipelinePackPool(1), router))
+
+		pack := NewPipelinePack(nil)
+		pack.Msg.Tag = "app"
+		pack.Msg.Data["message"] = "not json"
+		in <- pack
+
+		errored := <-router
+		So(errored.Label, ShouldEqual, ErrorLabel)
+		So(errored.Msg.Tag, ShouldEqual, "app")
+		So(errored.Msg.Data["message"], ShouldEqual, "not json")
+
+		res := <-router
+		So(res, ShouldEqual, pack)
+		So(res.Label, ShouldEqual, "")
+		So(res.Msg.Data["message"], ShouldEqual, "not json")
+	})
+
+	Convey("Records with fields of invalid types are kept parsed", t, func() {
+		parser := new(filterParser)
+		err := parser.Init(map[string]string{
+			"key_name": "message",
+			"format":   "json",
+			"types":    "code:integer",
+		})
+		So(err, ShouldEqual, nil)
+
+		in := make(chan *PipelinePack, 1)
+		router := make(chan *PipelinePack, 1)
+		go parser.Run(NewFilterRunner(in, nil, router))
+
+		pack := NewPipelinePack(nil)
+		pack.Msg.Data["message"] = `{"code":"x","text":"disk full"}`
+		in <- pack
+
+		res := <-router
+		So(res.Label, ShouldEqual, ErrorLabel)
+		So(res.Msg.Data["code"], ShouldEqual, "x")
+		So(res.Msg.Data["text"], ShouldEqual, "disk full")
+		So(res.Msg.Data["message"], ShouldEqual, nil)
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type piiDetector struct {
+	re *regexp.Regexp
+	// valid filters out false positives of re, it may be nil
+	valid func(string) bool
+}
+
+// Built-in detectors. When the regexp has a capture group only the group is
+// redacted, e.g. the value following "password=".
+var piiDetectors = map[string]*piiDetector{
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"ipv4": {
+		re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`),
+	},
+	"ipv6": {
+		re: regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`),
+		valid: func(s string) bool {
+			return net.ParseIP(s) != nil
+		},
+	},
+	"credit_card": {
+		re:    regexp.MustCompile(`\b(?:[0-9][ -]?){12,18}[0-9]\b`),
+		valid: luhn,
+	},
+	"token": {
+		re: regexp.MustCompile(`(?i)\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+|\bAKIA[0-9A-Z]{16}\b|(?:\bbearer\s+|\b(?:token|api_?key|secret|password|passwd)\s*[=:]\s*)([^\s&"',;]+)`),
+	},
+}
+
+// luhn validates the check digit of a credit card number.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+type piiRule struct {
+	key       string
+	action    string
+	pattern   *regexp.Regexp
+	replace   string
+	length    int
+	secret    []byte
+	detectors []*piiDetector
+}
+
+type filterPii struct {
+	rules     []*piiRule
+	mask_char string
+}
+
+func (self *filterPii) Init(cf map[string]string) error {
+	self.mask_char = "*"
+
+	value := cf["mask_char"]
+	if len(value) > 0 {
+		self.mask_char = value
+	}
+
+	for i, section := range Sections(cf, "rule") {
+		rule := new(piiRule)
+
+		rule.key = section["key"]
+		if len(rule.key) == 0 {
+			return fmt.Errorf("rule %d: key is required", i)
+		}
+
+		rule.action = section["action"]
+		if len(rule.action) == 0 {
+			rule.action = "mask"
+		}
+
+		value = section["detect"]
+		if len(value) > 0 {
+			for _, name := range strings.Split(value, ",") {
+				detector, ok := piiDetectors[strings.TrimSpace(name)]
+				if !ok {
+					return fmt.Errorf("rule %d: unknown detector %s", i, name)
+				}
+				rule.detectors = append(rule.detectors, detector)
+			}
+		}
+
+		switch rule.action {
+		case "mask", "hash", "drop":
+		case "replace":
+			rule.replace = section["replace"]
+			value = section["pattern"]
+			if len(value) > 0 {
+				re, err := regexp.Compile(value)
+				if err != nil {
+					return err
+				}
+				rule.pattern = re
+			} else if len(rule.detectors) == 0 {
+				return fmt.Errorf("rule %d: pattern or detect is required", i)
+			}
+		case "hmac":
+			value = section["secret"]
+			if len(value) == 0 {
+				value = cf["secret"]
+			}
+			if len(value) == 0 {
+				return fmt.Errorf("rule %d: secret is required", i)
+			}
+			rule.secret = []byte(value)
+		case "truncate":
+			if len(rule.detectors) > 0 {
+				return fmt.Errorf("rule %d: truncate can not be combined with detect", i)
+			}
+			length, err := strconv.Atoi(section["length"])
+			if err != nil {
+				return fmt.Errorf("rule %d: length is required", i)
+			}
+			rule.length = length
+		default:
+			return fmt.Errorf("rule %d: unknown action %s", i, rule.action)
+		}
+
+		self.rules = append(self.rules, rule)
+	}
+
+	if len(self.rules) == 0 {
+		return errors.New("no <rule> configured")
+	}
+
+	return nil
+}
+
+func (self *filterPii) Run(runner FilterRunner) error {
+	for {
+		pack := <-runner.InChan()
+		self.redact(pack.Msg.Data)
+		runner.RouterChan() <- pack
+	}
+}
+
+// redact applies the rules in order. A rule with key "*" applies to every
+// string value of the record, including the ones of nested maps and arrays.
+func (self *filterPii) redact(data map[string]interface{}) {
+	for _, rule := range self.rules {
+		if rule.key != "*" {
+			if v, ok := data[rule.key]; ok {
+				self.apply(rule, data, rule.key, v)
+			}
+			continue
+		}
+
+		self.redactValues(rule, data)
+	}
+}
+
+func (self *filterPii) redactValues(rule *piiRule, data map[string]interface{}) {
+	for k, v := range data {
+		switch v := v.(type) {
+		case string, []byte:
+			self.apply(rule, data, k, v)
+		case map[string]interface{}:
+			self.redactValues(rule, v)
+		case []interface{}:
+			// each item is redacted as the value of a map, the items
+			// dropped are removed from the array
+			items := v[:0]
+			for _, item := range v {
+				m := map[string]interface{}{"": item}
+				self.redactValues(rule, m)
+				if item, ok := m[""]; ok {
+					items = append(items, item)
+				}
+			}
+			data[k] = items
+		}
+	}
+}
+
+func (self *filterPii) apply(rule *piiRule, data map[string]interface{}, key string, v interface{}) {
+	var str string
+	switch v := v.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		if len(rule.detectors) > 0 {
+			return
+		}
+		str = fmt.Sprint(v)
+	}
+
+	if len(rule.detectors) == 0 {
+		if rule.action == "drop" {
+			delete(data, key)
+		} else if rule.pattern != nil {
+			data[key] = rule.pattern.ReplaceAllString(str, rule.replace)
+		} else {
+			data[key] = self.transform(rule, str)
+		}
+		return
+	}
+
+	found := false
+	for _, detector := range rule.detectors {
+		str = replaceDetected(detector, str, func(s string) string {
+			found = true
+			return self.transform(rule, s)
+		})
+	}
+
+	if found && rule.action == "drop" {
+		delete(data, key)
+	} else if found {
+		data[key] = str
+	}
+}
+
+func (self *filterPii) transform(rule *piiRule, s string) string {
+	switch rule.action {
+	case "mask":
+		return strings.Repeat(self.mask_char, utf8.RuneCountInString(s))
+	case "hash":
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	case "hmac":
+		mac := hmac.New(sha256.New, rule.secret)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	case "truncate":
+		if utf8.RuneCountInString(s) > rule.length {
+			return string([]rune(s)[:rule.length])
+		}
+		return s
+	case "replace":
+		return rule.replace
+	}
+	return s
+}
+
+// replaceDetected replaces the matches of detector in s, or their first
+// capture group when the regexp has one.
+func replaceDetected(detector *piiDetector, s string, repl func(string) string) string {
+	matches := detector.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var buf []byte
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if detector.valid != nil && !detector.valid(s[start:end]) {
+			continue
+		}
+		buf = append(buf, s[last:start]...)
+		buf = append(buf, repl(s[start:end])...)
+		last = end
+	}
+	buf = append(buf, s[last:]...)
+
+	return string(buf)
+}
+
+func init() {
+	RegisterFilter("pii", func() interface{} {
+		return new(filterPii)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestPiiFilter(t *testing.T) {
+	cf := map[string]string{
+		"secret":         "s3cr3t",
+		"rule.0":         "",
+		"rule.0.key":     "user",
+		"rule.0.action":  "hmac",
+		"rule.1":         "",
+		"rule.1.key":     "cmdline",
+		"rule.1.detect":  "token,email",
+		"rule.1.action":  "mask",
+		"rule.2":         "",
+		"rule.2.key":     "*",
+		"rule.2.detect":  "ipv4,ipv6,credit_card",
+		"rule.2.action":  "hash",
+		"rule.3":         "",
+		"rule.3.key":     "path",
+		"rule.3.action":  "replace",
+		"rule.3.pattern": "^/home/[^/]+",
+		"rule.3.replace": "/home/USER",
+		"rule.4":         "",
+		"rule.4.key":     "env",
+		"rule.4.action":  "drop",
+		"rule.5":         "",
+		"rule.5.key":     "args",
+		"rule.5.action":  "truncate",
+		"rule.5.length":  "5",
+	}
+	pii := new(filterPii)
+
+	Convey("Init pii filter plugin", t, func() {
+		err := pii.Init(cf)
+		So(err, ShouldEqual, nil)
+		So(len(pii.rules), ShouldEqual, 6)
+	})
+
+	Convey("Records are redacted by the rules", t, func() {
+		data := map[string]interface{}{
+			"user":    "root",
+			"cmdline": "curl -H 'Authorization: Bearer abc.def' --data password=hunter2 mailto:admin@example.com",
+			"src":     "login from 192.168.1.10 and fe80::1 at 12:30:45",
+			"card":    "paid with 4111 1111 1111 1111, order 1234567890123",
+			"path":    "/home/alice/.ssh/id_rsa",
+			"env":     "SECRET=1",
+			"args":    "--verbose",
+			"pid":     1234,
+		}
+		pii.redact(data)
+
+		So(data["user"], ShouldNotEqual, "root")
+		So(len(data["user"].(string)), ShouldEqual, 64)
+		So(data["cmdline"], ShouldEqual, "curl -H 'Authorization: Bearer *******' --data password=******* mailto:*****************")
+		So(data["src"], ShouldNotContainSubstring, "192.168.1.10")
+		So(data["src"], ShouldNotContainSubstring, "fe80::1")
+		So(data["src"], ShouldEndWith, " at 12:30:45")
+		So(data["card"], ShouldNotContainSubstring, "4111")
+		So(data["card"], ShouldEndWith, "order 1234567890123")
+		So(data["path"], ShouldEqual, "/home/USER/.ssh/id_rsa")
+		So(data["env"], ShouldEqual, nil)
+		So(data["args"], ShouldEqual, "--ver")
+		So(data["pid"], ShouldEqual, 1234)
+	})
+
+	Convey("Nested values are redacted by the rules on every key", t, func() {
+		data := map[string]interface{}{
+			"request": map[string]interface{}{
+				"client": "192.168.1.10",
+				"hops":   []interface{}{"10.0.0.1", map[string]interface{}{"via": "fe80::1"}, 3},
+			},
+		}
+		pii.redact(data)
+
+		request := data["request"].(map[string]interface{})
+		So(request["client"], ShouldNotEqual, "192.168.1.10")
+		So(len(request["client"].(string)), ShouldEqual, 64)
+
+		hops := request["hops"].([]interface{})
+		So(len(hops), ShouldEqual, 3)
+		So(hops[0], ShouldNotEqual, "10.0.0.1")
+		So(hops[1].(map[string]interface{})["via"], ShouldNotEqual, "fe80::1")
+		So(hops[2], ShouldEqual, 3)
+
+		drop := new(filterPii)
+		err := drop.Init(map[string]string{
+			"rule.0":        "",
+			"rule.0.key":    "*",
+			"rule.0.detect": "email",
+			"rule.0.action": "drop",
+		})
+		So(err, ShouldEqual, nil)
+
+		data = map[string]interface{}{"to": []interface{}{"admin@example.com", "ops"}}
+		drop.redact(data)
+		So(data["to"], ShouldResemble, []interface{}{"ops"})
+	})
+
+	Convey("Hashes are stable", t, func() {
+		one := map[string]interface{}{"src": "10.0.0.1"}
+		two := map[string]interface{}{"src": "from 10.0.0.1"}
+		pii.redact(one)
+		pii.redact(two)
+		So(strings.HasSuffix(two["src"].(string), one["src"].(string)), ShouldEqual, true)
+	})
+
+	Convey("Invalid rules are rejected", t, func() {
+		err := new(filterPii).Init(map[string]string{
+			"rule.0":        "",
+			"rule.0.key":    "user",
+			"rule.0.action": "hmac",
+		})
+		So(err, ShouldNotEqual, nil)
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttleEvent is a delayed event. It is copied out of its pack, which is
+// recycled at once so that a noisy group can not hold the packs of the input
+// shared with the other groups.
+type throttleEvent struct {
+	msg         Message
+	msgBytes    []byte
+	filterIndex int
+	label       string
+	rewrites    int
+}
+
+type throttleGroup struct {
+	tag         string
+	filterIndex int
+	count       int
+	throttled   int
+	delayed     []*throttleEvent
+}
+
+type filterThrottle struct {
+	group_key  []string
+	rate_limit int
+	period     int
+	delay      bool
+	summary    bool
+
+	groups map[string]*throttleGroup
+}
+
+func (self *filterThrottle) Init(cf map[string]string) error {
+	self.rate_limit = 1000
+	self.period = 60
+	self.summary = true
+	self.groups = make(map[string]*throttleGroup)
+
+	value := cf["group_key"]
+	if len(value) > 0 {
+		for _, key := range strings.Split(value, ",") {
+			self.group_key = append(self.group_key, strings.TrimSpace(key))
+		}
+	}
+
+	value = cf["rate_limit"]
+	if len(value) > 0 {
+		rate_limit, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.rate_limit = rate_limit
+	}
+
+	value = cf["period"]
+	if len(value) > 0 {
+		period, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if period <= 0 {
+			return fmt.Errorf("invalid period %d", period)
+		}
+		self.period = period
+	}
+
+	value = cf["mode"]
+	if len(value) > 0 {
+		if value == "delay" {
+			self.delay = true
+		} else if value != "drop" {
+			return fmt.Errorf("unknown mode %s", value)
+		}
+	}
+
+	value = cf["summary"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.summary = false
+		}
+	}
+
+	return nil
+}
+
+func (self *filterThrottle) Run(runner FilterRunner) error {
+	tick := time.NewTicker(time.Second * time.Duration(self.period))
+
+	for {
+		select {
+		case <-tick.C:
+			{
+				self.reset(runner)
+			}
+		case pack := <-runner.InChan():
+			{
+				self.throttle(runner, pack)
+			}
+		}
+	}
+}
+
+func (self *filterThrottle) throttle(runner FilterRunner, pack *PipelinePack) {
+	group := self.group(pack)
+
+	if group.count < self.rate_limit && len(group.delayed) == 0 {
+		group.count++
+		runner.RouterChan() <- pack
+		return
+	}
+
+	if self.delay && len(group.delayed) < self.rate_limit {
+		group.delayed = append(group.delayed, &throttleEvent{
+			msg:         pack.Msg,
+			msgBytes:    append([]byte(nil), pack.MsgBytes...),
+			filterIndex: pack.FilterIndex,
+			label:       pack.Label,
+			rewrites:    pack.Rewrites,
+		})
+		pack.Recycle()
+		return
+	}
+
+	group.throttled++
+	pack.Recycle()
+}
+
+func (self *filterThrottle) group(pack *PipelinePack) *throttleGroup {
+	key := pack.Msg.Tag
+	if len(self.group_key) > 0 {
+		values := make([]string, len(self.group_key))
+		for i, k := range self.group_key {
+			if v, ok := pack.Msg.Data[k]; ok {
+				values[i] = fmt.Sprint(v)
+			}
+		}
+		key = strings.Join(values, ",")
+	}
+
+	group, ok := self.groups[key]
+	if !ok {
+		group = new(throttleGroup)
+		self.groups[key] = group
+	}
+	group.tag = pack.Msg.Tag
+	group.filterIndex = pack.FilterIndex
+
+	return group
+}
+
+// reset starts a new period: the delayed events are released within the new
+// rate limit and a summary is emitted for every group that was throttled.
+func (self *filterThrottle) reset(runner FilterRunner) {
+	for key, group := range self.groups {
+		group.count = 0
+
+		for len(group.delayed) > 0 && group.count < self.rate_limit {
+			event := group.delayed[0]
+			pack := <-runner.RecycleChan()
+			pack.Msg = event.msg
+			pack.MsgBytes = append(pack.MsgBytes[:0], event.msgBytes...)
+			pack.FilterIndex = event.filterIndex
+			pack.Label = event.label
+			pack.Rewrites = event.rewrites
+			runner.RouterChan() <- pack
+
+			group.delayed[0] = nil
+			group.delayed = group.delayed[1:]
+			group.count++
+		}
+
+		if group.throttled > 0 && self.summary {
+			pack := <-runner.RecycleChan()
+			pack.Msg.Tag = group.tag
+			pack.Msg.Timestamp = time.Now().UnixNano()
+			pack.Msg.Data["message"] = fmt.Sprintf("throttled %d events", group.throttled)
+			pack.Msg.Data["group"] = key
+			pack.Msg.Data["throttled"] = group.throttled
+			pack.FilterIndex = group.filterIndex
+			runner.RouterChan() <- pack
+		}
+		group.throttled = 0
+
+		if group.count == 0 {
+			delete(self.groups, key)
+		}
+	}
+}
+
+func init() {
+	RegisterFilter("throttle", func() interface{} {
+		return new(filterThrottle)
+	})
+}
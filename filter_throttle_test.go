@@ -0,0 +1,72 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestThrottleFilter(t *testing.T) {
+	router := make(chan *PipelinePack, 10)
+	fRunner := NewFilterRunner(nil, NewPipelinePackPool(2), router)
+
+	newPack := func(service string) *PipelinePack {
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		pack.Msg.Tag = "test.throttle"
+		pack.Msg.Data["service"] = service
+		return pack
+	}
+
+	Convey("Noisy groups are dropped and summarized", t, func() {
+		throttle := new(filterThrottle)
+		err := throttle.Init(map[string]string{
+			"group_key":  "service",
+			"rate_limit": "2",
+		})
+		So(err, ShouldEqual, nil)
+
+		for i := 0; i < 5; i++ {
+			throttle.throttle(fRunner, newPack("noisy"))
+		}
+		throttle.throttle(fRunner, newPack("quiet"))
+
+		for i := 0; i < 3; i++ {
+			res := <-router
+			So(res.Msg.Data["service"], ShouldNotEqual, nil)
+		}
+
+		throttle.reset(fRunner)
+		summary := <-router
+		So(summary.Msg.Data["message"], ShouldEqual, "throttled 3 events")
+		So(summary.Msg.Data["group"], ShouldEqual, "noisy")
+		So(summary.Msg.Tag, ShouldEqual, "test.throttle")
+	})
+
+	Convey("Delayed events are released in the next period", t, func() {
+		throttle := new(filterThrottle)
+		err := throttle.Init(map[string]string{
+			"rate_limit": "1",
+			"mode":       "delay",
+		})
+		So(err, ShouldEqual, nil)
+
+		first, second := newPack("a"), newPack("b")
+		throttle.throttle(fRunner, first)
+		throttle.throttle(fRunner, second)
+		So(<-router, ShouldEqual, first)
+		So(len(router), ShouldEqual, 0)
+
+		// the pack of the delayed event is recycled at once
+		So(len(second.RecycleChan), ShouldEqual, 1)
+
+		throttle.reset(fRunner)
+		released := <-router
+		So(released.Msg.Data["service"], ShouldEqual, "b")
+		So(released.Msg.Tag, ShouldEqual, "test.throttle")
+		So(len(router), ShouldEqual, 0)
+	})
+
+	Convey("The period must be positive", t, func() {
+		So(new(filterThrottle).Init(map[string]string{"period": "0"}), ShouldNotEqual, nil)
+		So(new(filterThrottle).Init(map[string]string{"period": "-1"}), ShouldNotEqual, nil)
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var formatter_plugins = make(map[string]func() interface{})
+
+func RegisterFormatter(name string, formatter func() interface{}) {
+	if formatter == nil {
+		log.Fatalln("formatter: Register formatter is nil")
+	}
+
+	if _, ok := formatter_plugins[name]; ok {
+		log.Fatalln("formatter: Register called twice for formatter " + name)
+	}
+
+	formatter_plugins[name] = formatter
+}
+
+// FormatSection returns the <format> section of a plugin config. Plugins
+// without one are configured with their own format parameter.
+func FormatSection(cf map[string]string) map[string]string {
+	sections := Sections(cf, "format")
+	if len(sections) > 0 {
+		return sections[0]
+	}
+	return legacySection(cf, "format")
+}
+
+// RecordFormatter serializes events with the formatter registered for the
+// configured format, after injecting the tag and the time into the record
+// when asked to.
+type RecordFormatter struct {
+	formatter        Formatter
+	include_tag_key  bool
+	tag_key          string
+	include_time_key bool
+	time_key         string
+	time             *timeFormatter
+}
+
+// NewRecordFormatter returns the formatter of cf, or of defaultFormat when
+// none is configured.
+func NewRecordFormatter(cf map[string]string, defaultFormat string) (*RecordFormatter, error) {
+	self := new(RecordFormatter)
+
+	format := cf["type"]
+	if len(format) == 0 {
+		format = defaultFormat
+	}
+
+	formatter_plugin, ok := formatter_plugins[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	self.formatter = formatter_plugin().(Formatter)
+	err := self.formatter.Init(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	self.tag_key = "tag"
+	self.time_key = "time"
+
+	value := cf["include_tag_key"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.include_tag_key = true
+		}
+	}
+
+	value = cf["tag_key"]
+	if len(value) > 0 {
+		self.tag_key = value
+	}
+
+	value = cf["include_time_key"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.include_time_key = true
+		}
+	}
+
+	value = cf["time_key"]
+	if len(value) > 0 {
+		self.time_key = value
+	}
+
+	self.time, err = newTimeFormatter(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// Format serializes msg. The record is copied before the tag and the time
+// are injected, as it may be shared with other outputs.
+func (self *RecordFormatter) Format(msg *Message) ([]byte, error) {
+	if !self.include_tag_key && !self.include_time_key {
+		return self.formatter.Format(msg)
+	}
+
+	record := make(map[string]interface{}, len(msg.Data)+2)
+	for k, v := range msg.Data {
+		record[k] = v
+	}
+	if self.include_tag_key {
+		record[self.tag_key] = msg.Tag
+	}
+	if self.include_time_key {
+		record[self.time_key] = self.time.Format(msg.Timestamp)
+	}
+
+	return self.formatter.Format(&Message{Tag: msg.Tag, Timestamp: msg.Timestamp, Data: record})
+}
+
+// timeFormatter formats event times as float or integer seconds, or as
+// strings with time_format.
+type timeFormatter struct {
+	time_type string
+	layout    string
+	location  *time.Location
+}
+
+func newTimeFormatter(cf map[string]string) (*timeFormatter, error) {
+	self := &timeFormatter{
+		time_type: "float",
+		layout:    time.RFC3339Nano,
+		location:  time.Local,
+	}
+
+	value := cf["time_format"]
+	if len(value) > 0 {
+		self.time_type = "string"
+		if strings.Contains(value, "%") {
+			layout, err := strftimeToLayout(value, true)
+			if err != nil {
+				return nil, err
+			}
+			self.layout = layout
+		} else {
+			self.layout = value
+		}
+	}
+
+	value = cf["time_type"]
+	if len(value) > 0 {
+		switch value {
+		case "string", "unixtime", "float":
+			self.time_type = value
+		default:
+			return nil, fmt.Errorf("unknown time_type %s", value)
+		}
+	}
+
+	if cf["localtime"] == "off" || cf["utc"] == "on" {
+		self.location = time.UTC
+	}
+
+	value = cf["timezone"]
+	if len(value) > 0 {
+		location, err := loadTimezone(value)
+		if err != nil {
+			return nil, err
+		}
+		self.location = location
+	}
+
+	return self, nil
+}
+
+func (self *timeFormatter) Format(timestamp int64) interface{} {
+	switch self.time_type {
+	case "unixtime":
+		return timestamp / int64(time.Second)
+	case "string":
+		return self.String(timestamp)
+	}
+	sec, nsec := timestamp/int64(time.Second), timestamp%int64(time.Second)
+	return float64(sec) + float64(nsec)/float64(time.Second)
+}
+
+func (self *timeFormatter) String(timestamp int64) string {
+	return time.Unix(0, timestamp).In(self.location).Format(self.layout)
+}
+
+// formatValue renders a field of a text format: strings as they are, maps
+// and arrays as JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+type formatterCsv struct {
+	fields       []string
+	delimiter    string
+	force_quotes bool
+}
+
+func (self *formatterCsv) Init(cf map[string]string) error {
+	self.delimiter = ","
+	self.force_quotes = true
+
+	value := cf["fields"]
+	if len(value) > 0 {
+		for _, field := range strings.Split(value, ",") {
+			self.fields = append(self.fields, strings.TrimSpace(field))
+		}
+	}
+	if len(self.fields) == 0 {
+		return errors.New("csv: fields is required")
+	}
+
+	value = cf["delimiter"]
+	if len(value) > 0 {
+		self.delimiter = value
+		if value == "TAB" {
+			self.delimiter = "\t"
+		}
+	}
+
+	value = cf["force_quotes"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.force_quotes = false
+		}
+	}
+
+	return nil
+}
+
+func (self *formatterCsv) Format(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, field := range self.fields {
+		if i > 0 {
+			buf.WriteString(self.delimiter)
+		}
+
+		value := formatValue(msg.Data[field])
+		if self.force_quotes || strings.ContainsAny(value, "\"\r\n"+self.delimiter) {
+			buf.WriteByte('"')
+			buf.WriteString(strings.Replace(value, `"`, `""`, -1))
+			buf.WriteByte('"')
+		} else {
+			buf.WriteString(value)
+		}
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func init() {
+	RegisterFormatter("csv", func() interface{} {
+		return new(formatterCsv)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// formatterHash writes records as Ruby hashes, e.g. {"code"=>200}, the way
+// fluentd's hash formatter does.
+type formatterHash struct {
+}
+
+func (self *formatterHash) Init(cf map[string]string) error {
+	return nil
+}
+
+func (self *formatterHash) Format(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	writeRubyValue(&buf, msg.Data)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeRubyValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("nil")
+	case string:
+		buf.WriteString(strconv.Quote(v))
+	case []byte:
+		buf.WriteString(strconv.Quote(string(v)))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(strconv.Quote(k))
+			buf.WriteString("=>")
+			writeRubyValue(buf, v[k])
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeRubyValue(buf, item)
+		}
+		buf.WriteByte(']')
+	default:
+		buf.WriteString(formatValue(v))
+	}
+}
+
+func init() {
+	RegisterFormatter("hash", func() interface{} {
+		return new(formatterHash)
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+type formatterJson struct {
+	add_newline bool
+}
+
+func (self *formatterJson) Init(cf map[string]string) error {
+	self.add_newline = true
+
+	value := cf["add_newline"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.add_newline = false
+		}
+	}
+
+	return nil
+}
+
+func (self *formatterJson) Format(msg *Message) ([]byte, error) {
+	b, err := json.Marshal(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.add_newline {
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
+func init() {
+	RegisterFormatter("json", func() interface{} {
+		return new(formatterJson)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+type formatterLtsv struct {
+	delimiter       string
+	label_delimiter string
+}
+
+func (self *formatterLtsv) Init(cf map[string]string) error {
+	self.delimiter = "\t"
+	self.label_delimiter = ":"
+
+	value := cf["delimiter"]
+	if len(value) > 0 {
+		self.delimiter = value
+	}
+
+	value = cf["label_delimiter"]
+	if len(value) > 0 {
+		self.label_delimiter = value
+	}
+
+	return nil
+}
+
+// Format writes the fields sorted by label, so that the output is stable.
+func (self *formatterLtsv) Format(msg *Message) ([]byte, error) {
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(self.delimiter)
+		}
+		buf.WriteString(k)
+		buf.WriteString(self.label_delimiter)
+		buf.WriteString(formatValue(msg.Data[k]))
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func init() {
+	RegisterFormatter("ltsv", func() interface{} {
+		return new(formatterLtsv)
+	})
+}
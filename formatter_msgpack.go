@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/ugorji/go/codec"
+)
+
+type formatterMsgpack struct {
+	codec *codec.MsgpackHandle
+}
+
+func (self *formatterMsgpack) Init(cf map[string]string) error {
+	self.codec = newForwardCodec()
+	return nil
+}
+
+func (self *formatterMsgpack) Format(msg *Message) ([]byte, error) {
+	var b []byte
+	err := codec.NewEncoderBytes(&b, self.codec).Encode(msg.Data)
+	return b, err
+}
+
+func init() {
+	RegisterFormatter("msgpack", func() interface{} {
+		return new(formatterMsgpack)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// formatterOutFile writes the time, the tag and the JSON record of each
+// event, the format of fluentd's out_file.
+type formatterOutFile struct {
+	delimiter   string
+	output_time bool
+	output_tag  bool
+	time        *timeFormatter
+}
+
+func (self *formatterOutFile) Init(cf map[string]string) error {
+	self.delimiter = "\t"
+	self.output_time = true
+	self.output_tag = true
+
+	value := cf["delimiter"]
+	if len(value) > 0 {
+		switch value {
+		case "SPACE":
+			self.delimiter = " "
+		case "COMMA":
+			self.delimiter = ","
+		case "TAB":
+			self.delimiter = "\t"
+		default:
+			self.delimiter = value
+		}
+	}
+
+	value = cf["output_time"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.output_time = false
+		}
+	}
+
+	value = cf["output_tag"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.output_tag = false
+		}
+	}
+
+	time, err := newTimeFormatter(cf)
+	if err != nil {
+		return err
+	}
+	self.time = time
+
+	return nil
+}
+
+func (self *formatterOutFile) Format(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if self.output_time {
+		buf.WriteString(self.time.String(msg.Timestamp))
+		buf.WriteString(self.delimiter)
+	}
+	if self.output_tag {
+		buf.WriteString(msg.Tag)
+		buf.WriteString(self.delimiter)
+	}
+
+	b, err := json.Marshal(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func init() {
+	RegisterFormatter("out_file", func() interface{} {
+		return new(formatterOutFile)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+type formatterSingleValue struct {
+	message_key string
+	add_newline bool
+}
+
+func (self *formatterSingleValue) Init(cf map[string]string) error {
+	self.message_key = "message"
+	self.add_newline = true
+
+	value := cf["message_key"]
+	if len(value) > 0 {
+		self.message_key = value
+	}
+
+	value = cf["add_newline"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.add_newline = false
+		}
+	}
+
+	return nil
+}
+
+func (self *formatterSingleValue) Format(msg *Message) ([]byte, error) {
+	b := []byte(formatValue(msg.Data[self.message_key]))
+	if self.add_newline && (len(b) == 0 || b[len(b)-1] != '\n') {
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
+func init() {
+	RegisterFormatter("single_value", func() interface{} {
+		return new(formatterSingleValue)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"testing"
+	"time"
+)
+
+func formatMsg(cf map[string]string, msg *Message) (string, error) {
+	formatter, err := NewRecordFormatter(cf, "json")
+	if err != nil {
+		return "", err
+	}
+
+	b, err := formatter.Format(msg)
+	return string(b), err
+}
+
+func TestRecordFormatter(t *testing.T) {
+	ts := time.Date(2015, 1, 1, 0, 0, 0, 123000000, time.UTC).UnixNano()
+	msg := &Message{
+		Tag:       "test.format",
+		Timestamp: ts,
+		Data: map[string]interface{}{
+			"code":    int64(200),
+			"message": `say "hi"`,
+		},
+	}
+
+	Convey("The <format> section configures the formatter", t, func() {
+		cf := FormatSection(map[string]string{
+			"type":          "stdout",
+			"format.0":      "",
+			"format.0.type": "single_value",
+		})
+		So(cf["type"], ShouldEqual, "single_value")
+
+		cf = FormatSection(map[string]string{"type": "stdout", "format": "ltsv"})
+		So(cf["type"], ShouldEqual, "ltsv")
+
+		_, err := formatMsg(map[string]string{"type": "unknown"}, msg)
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("Tag and time are injected into a copy of the record", t, func() {
+		out, err := formatMsg(map[string]string{
+			"include_tag_key":  "on",
+			"include_time_key": "on",
+			"time_format":      "%Y-%m-%dT%H:%M:%S.%L%z",
+			"utc":              "on",
+		}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, `{"code":200,"message":"say \"hi\"","tag":"test.format","time":"2015-01-01T00:00:00.123+0000"}`+"\n")
+		So(len(msg.Data), ShouldEqual, 2)
+
+		out, err = formatMsg(map[string]string{"include_time_key": "on", "time_key": "ts"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, `{"code":200,"message":"say \"hi\"","ts":1420070400.123}`+"\n")
+	})
+
+	Convey("msgpack", t, func() {
+		out, err := formatMsg(map[string]string{"type": "msgpack"}, msg)
+		So(err, ShouldEqual, nil)
+
+		var record map[string]interface{}
+		err = codec.NewDecoderBytes([]byte(out), newForwardCodec()).Decode(&record)
+		So(err, ShouldEqual, nil)
+		So(record["message"], ShouldEqual, `say "hi"`)
+	})
+
+	Convey("ltsv", t, func() {
+		out, err := formatMsg(map[string]string{"type": "ltsv"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "code:200\tmessage:say \"hi\"\n")
+	})
+
+	Convey("csv", t, func() {
+		out, err := formatMsg(map[string]string{"type": "csv", "fields": "code,message,missing"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, `"200","say ""hi""",""`+"\n")
+
+		out, err = formatMsg(map[string]string{"type": "csv", "fields": "code,message", "force_quotes": "off"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, `200,"say ""hi"""`+"\n")
+
+		_, err = formatMsg(map[string]string{"type": "csv"}, msg)
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("single_value", t, func() {
+		out, err := formatMsg(map[string]string{"type": "single_value"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "say \"hi\"\n")
+	})
+
+	Convey("out_file", t, func() {
+		out, err := formatMsg(map[string]string{"type": "out_file", "time_format": "%Y-%m-%dT%H:%M:%S%:z", "utc": "on"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "2015-01-01T00:00:00+00:00\ttest.format\t"+`{"code":200,"message":"say \"hi\""}`+"\n")
+
+		out, err = formatMsg(map[string]string{"type": "out_file", "output_time": "off", "delimiter": "SPACE"}, msg)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "test.format "+`{"code":200,"message":"say \"hi\""}`+"\n")
+	})
+
+	Convey("hash", t, func() {
+		nested := &Message{Data: map[string]interface{}{
+			"a": []interface{}{int64(1), nil},
+			"b": map[string]interface{}{"c": "d"},
+		}}
+		out, err := formatMsg(map[string]string{"type": "hash"}, nested)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, `{"a"=>[1, nil], "b"=>{"c"=>"d"}}`+"\n")
+	})
+}
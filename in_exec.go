@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// execRestartDelay is the time before a streaming command is run again
+	// once it exited.
+	execRestartDelay = time.Second
+	// execStderrLimit bounds the end of the stderr kept for error events.
+	execStderrLimit = 4096
+)
+
+type inputExec struct {
+	tag          string
+	command      string
+	run_interval time.Duration
+	timeout      time.Duration
+	parser       *RecordParser
+}
+
+func (self *inputExec) Init(cf map[string]string) error {
+	value := cf["tag"]
+	if len(value) > 0 {
+		self.tag = value
+	} else {
+		return errors.New("tag is required")
+	}
+
+	value = cf["command"]
+	if len(value) > 0 {
+		self.command = value
+	} else {
+		return errors.New("command is required")
+	}
+
+	value = cf["run_interval"]
+	if len(value) > 0 {
+		run_interval, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.run_interval = time.Duration(run_interval) * time.Second
+	}
+
+	value = cf["timeout"]
+	if len(value) > 0 {
+		timeout, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.timeout = time.Duration(timeout) * time.Second
+	}
+
+	// a streaming command runs until it exits
+	if self.timeout > 0 && self.run_interval == 0 {
+		return errors.New("timeout requires run_interval")
+	}
+
+	section := ParseSection(cf)
+	if len(section["type"]) == 0 {
+		section["type"] = "none"
+	}
+
+	parser, err := NewRecordParser(section)
+	if err != nil {
+		return err
+	}
+	self.parser = parser
+
+	return nil
+}
+
+// Run runs the command every run_interval, or keeps it running when there
+// is no run_interval, and emits each line of its output as an event.
+func (self *inputExec) Run(runner InputRunner) error {
+	if self.run_interval == 0 {
+		for {
+			self.execute(runner)
+			time.Sleep(execRestartDelay)
+		}
+	}
+
+	tick := time.NewTicker(self.run_interval)
+	defer tick.Stop()
+
+	for {
+		self.execute(runner)
+		<-tick.C
+	}
+}
+
+// execute runs the command once. It is killed with its children after
+// timeout. Failures to start it, timeouts and non-zero exit codes are
+// emitted as error events.
+func (self *inputExec) execute(runner InputRunner) {
+	cmd := exec.Command("/bin/sh", "-c", self.command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stderr := &lastBytes{limit: execStderrLimit}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		self.emitError(runner, err.Error(), -1, "")
+		return
+	}
+
+	var timedOut bool
+	var mu sync.Mutex
+	if self.timeout > 0 {
+		timer := time.AfterFunc(self.timeout, func() {
+			mu.Lock()
+			timedOut = true
+			mu.Unlock()
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	for scanner.Scan() {
+		self.emit(runner, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("exec: read failed, command:", self.command, "err:", err)
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	err = cmd.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case timedOut:
+		self.emitError(runner, fmt.Sprintf("timed out after %v", self.timeout), -1, stderr.String())
+	case err != nil:
+		code := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				code = status.ExitStatus()
+			}
+		}
+		self.emitError(runner, err.Error(), code, stderr.String())
+	}
+}
+
+func (self *inputExec) emit(runner InputRunner, line []byte) {
+	pack := <-runner.InChan()
+	pack.MsgBytes = append(pack.MsgBytes[:0], line...)
+	pack.Msg.Tag = self.tag
+	pack.Msg.Timestamp = time.Now().UnixNano()
+
+	err := self.parser.Parse(line, &pack.Msg)
+	if _, ok := err.(*TypeError); ok {
+		log.Println("exec: parser.Parse", err)
+		pack.Label = ErrorLabel
+	} else if err != nil {
+		log.Println("exec: parser.Parse", err)
+		pack.Recycle()
+		return
+	}
+
+	runner.RouterChan() <- pack
+}
+
+// emitError routes an event about a failed run of the command to the
+// @ERROR label.
+func (self *inputExec) emitError(runner InputRunner, message string, code int, stderr string) {
+	log.Println("exec: command failed:", self.command, "err:", message)
+
+	pack := <-runner.InChan()
+	pack.MsgBytes = pack.MsgBytes[:0]
+	pack.Msg.Tag = self.tag
+	pack.Msg.Timestamp = time.Now().UnixNano()
+	pack.Msg.Data = map[string]interface{}{
+		"command":   self.command,
+		"error":     message,
+		"exit_code": code,
+		"stderr":    stderr,
+	}
+	pack.Label = ErrorLabel
+
+	runner.RouterChan() <- pack
+}
+
+// lastBytes keeps the last limit bytes written to it.
+type lastBytes struct {
+	limit int
+	buf   []byte
+}
+
+func (self *lastBytes) Write(p []byte) (int, error) {
+	self.buf = append(self.buf, p...)
+	if len(self.buf) > self.limit {
+		self.buf = append(self.buf[:0], self.buf[len(self.buf)-self.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (self *lastBytes) String() string {
+	return string(self.buf)
+}
+
+func init() {
+	RegisterInput("exec", func() interface{} {
+		return new(inputExec)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestExecInput(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("The output is parsed line by line on each run", t, func() {
+		router, _ := startInput(t, new(inputExec), map[string]string{
+			"tag":          "exec",
+			"command":      `echo '{"n":1}'; echo '{"n":2}'`,
+			"run_interval": "1",
+			"format":       "json",
+		}, 10)
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "exec")
+		So(pack.Msg.Data["n"], ShouldEqual, 1)
+		So(pack.Label, ShouldEqual, "")
+
+		pack = <-router
+		So(pack.Msg.Data["n"], ShouldEqual, 2)
+
+		pack = <-router
+		So(pack.Msg.Data["n"], ShouldEqual, 1)
+	})
+
+	Convey("Non-zero exit codes are error events", t, func() {
+		router, _ := startInput(t, new(inputExec), map[string]string{
+			"tag":          "exec",
+			"command":      "echo out; echo failure >&2; exit 3",
+			"run_interval": "60",
+		}, 10)
+
+		pack := <-router
+		So(pack.Msg.Data["message"], ShouldEqual, "out")
+
+		pack = <-router
+		So(pack.Label, ShouldEqual, ErrorLabel)
+		So(pack.Msg.Data["exit_code"], ShouldEqual, 3)
+		So(pack.Msg.Data["stderr"], ShouldEqual, "failure\n")
+	})
+
+	Convey("Commands running longer than timeout are killed", t, func() {
+		router, _ := startInput(t, new(inputExec), map[string]string{
+			"tag":          "exec",
+			"command":      "sleep 10 | cat",
+			"run_interval": "60",
+			"timeout":      "1",
+		}, 10)
+
+		select {
+		case pack := <-router:
+			So(pack.Label, ShouldEqual, ErrorLabel)
+			So(pack.Msg.Data["error"], ShouldEqual, "timed out after 1s")
+		case <-time.After(5 * time.Second):
+			t.Fatal("the command was not killed")
+		}
+	})
+
+	Convey("Streaming commands are restarted once they exit", t, func() {
+		router, _ := startInput(t, new(inputExec), map[string]string{
+			"tag":     "exec",
+			"command": "echo started",
+		}, 10)
+
+		So((<-router).Msg.Data["message"], ShouldEqual, "started")
+		So((<-router).Msg.Data["message"], ShouldEqual, "started")
+	})
+
+	Convey("A command and a tag are required", t, func() {
+		So(new(inputExec).Init(map[string]string{"tag": "exec"}), ShouldNotEqual, nil)
+		So(new(inputExec).Init(map[string]string{"command": "true"}), ShouldNotEqual, nil)
+	})
+
+	Convey("A timeout requires a run_interval", t, func() {
+		So(new(inputExec).Init(map[string]string{"tag": "exec", "command": "true", "timeout": "1"}), ShouldNotEqual, nil)
+	})
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -9,6 +16,8 @@ import (
 type InputForward struct {
 	Host string
 	Port string
+
+	codec *codec.MsgpackHandle
 }
 
 func (this *InputForward) Init(cf map[string]string) error {
@@ -26,37 +35,196 @@ func (this *InputForward) Init(cf map[string]string) error {
 		log.Panicln("No port info configured.")
 	}
 
+	this.codec = newForwardCodec()
+
 	return nil
 }
 
-func (this *InputForward) Run(runner iRunner) error {
-	var listener net.Listener
+func (this *InputForward) Run(runner InputRunner) error {
 	var conn net.Conn
 	var err error
 	var wg sync.WaitGroup
 
+	listener, err := net.Listen("tcp", net.JoinHostPort(this.Host, this.Port))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
 	for {
 		if conn, err = listener.Accept(); err != nil {
-			if err.(net.Error).Temporary() {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				log.Println("TCP accept failed:", err)
 				continue
 			} else {
 				break
 			}
+		}
 
-			wg.Add(1)
+		wg.Add(1)
 
-			go this.handleConn(conn, wg)
-		}
+		go this.handleConn(runner, conn, &wg)
 	}
 
 	wg.Wait()
-	return nil
+	return err
 }
 
-func (this *InputForward) handleConn(conn net.Conn, wg sync.WaitGroup) {
+func (this *InputForward) handleConn(runner InputRunner, conn net.Conn, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer conn.Close()
+
+	dec := codec.NewDecoder(bufio.NewReader(conn), this.codec)
+	enc := codec.NewEncoder(conn, this.codec)
+
+	for {
+		var entry []interface{}
+		err := dec.Decode(&entry)
+		if err != nil {
+			if err != io.EOF {
+				log.Println("forward: decode failed, remote:", conn.RemoteAddr(), "err:", err)
+			}
+			return
+		}
+
+		option, err := this.emit(runner, entry)
+		if err != nil {
+			log.Println("forward: invalid entry, remote:", conn.RemoteAddr(), "err:", err)
+			return
+		}
+
+		if chunk, ok := option["chunk"]; ok {
+			err = enc.Encode(map[string]interface{}{"ack": chunk})
+			if err != nil {
+				log.Println("forward: ack failed, remote:", conn.RemoteAddr(), "err:", err)
+				return
+			}
+		}
+	}
+}
+
+// emit routes the events of an entry of the forward protocol. Depending on
+// its second element the entry is in Message mode [tag, time, record],
+// Forward mode [tag, [[time, record], ...]] or PackedForward mode
+// [tag, msgpack stream of [time, record]], gzipped when the option says
+// compressed. The time is an EventTime or integer seconds.
+func (this *InputForward) emit(runner InputRunner, entry []interface{}) (map[string]interface{}, error) {
+	if len(entry) < 2 {
+		return nil, errors.New("entry is too short")
+	}
+
+	tag, ok := entry[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid tag %v", entry[0])
+	}
 
+	if timestamp, ok := toTimestamp(entry[1]); ok {
+		if len(entry) < 3 {
+			return nil, errors.New("record is missing")
+		}
+		record, ok := entry[2].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid record %v", entry[2])
+		}
+		this.send(runner, tag, timestamp, record)
+		return optionOf(entry, 3), nil
+	}
+
+	option := optionOf(entry, 2)
+
+	var events []interface{}
+	switch v := entry[1].(type) {
+	case []interface{}:
+		events = v
+	case []byte:
+		b, err := this.decompress(v, option)
+		if err != nil {
+			return nil, err
+		}
+		events, err = this.unpack(b)
+		if err != nil {
+			return nil, err
+		}
+	case string:
+		b, err := this.decompress([]byte(v), option)
+		if err != nil {
+			return nil, err
+		}
+		events, err = this.unpack(b)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid entry %v", entry[1])
+	}
+
+	for _, event := range events {
+		pair, ok := event.([]interface{})
+		if !ok || len(pair) < 2 {
+			return nil, fmt.Errorf("invalid event %v", event)
+		}
+		timestamp, ok := toTimestamp(pair[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid time %v", pair[0])
+		}
+		record, ok := pair[1].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid record %v", pair[1])
+		}
+		this.send(runner, tag, timestamp, record)
+	}
+
+	return option, nil
+}
+
+func (this *InputForward) decompress(b []byte, option map[string]interface{}) ([]byte, error) {
+	if option["compressed"] != "gzip" {
+		return b, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+func (this *InputForward) unpack(b []byte) ([]interface{}, error) {
+	var events []interface{}
+
+	dec := codec.NewDecoderBytes(b, this.codec)
+	for {
+		var event interface{}
+		err := dec.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+func (this *InputForward) send(runner InputRunner, tag string, timestamp int64, record map[string]interface{}) {
+	pack := <-runner.InChan()
+	pack.Msg.Tag = tag
+	pack.Msg.Timestamp = timestamp
+	pack.Msg.Data = record
+	runner.RouterChan() <- pack
+}
+
+func optionOf(entry []interface{}, i int) map[string]interface{} {
+	if len(entry) > i {
+		if option, ok := entry[i].(map[string]interface{}); ok {
+			return option
+		}
+	}
+	return nil
 }
 
 func init() {
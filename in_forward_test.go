@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestForwardInput(t *testing.T) {
+	forward := new(InputForward)
+	forward.Init(map[string]string{"bind": "127.0.0.1", "port": "24299"})
+
+	router := make(chan *PipelinePack, 10)
+	go forward.Run(NewInputRunner(NewPipelinePackPool(10), router))
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", "127.0.0.1:24299")
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	h := newForwardCodec()
+	enc := codec.NewEncoder(conn, h)
+	ts := time.Date(2015, 1, 1, 0, 0, 0, 123456789, time.UTC).UnixNano()
+
+	Convey("Message mode keeps nanoseconds", t, func() {
+		err := enc.Encode([]interface{}{"test.forward", EventTime(ts), map[string]interface{}{"a": 1}})
+		So(err, ShouldEqual, nil)
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "test.forward")
+		So(pack.Msg.Timestamp, ShouldEqual, ts)
+		So(pack.Msg.Data["a"], ShouldEqual, 1)
+	})
+
+	Convey("Forward mode accepts integer seconds", t, func() {
+		err := enc.Encode([]interface{}{"test.forward", []interface{}{
+			[]interface{}{1420070400, map[string]interface{}{"a": 1}},
+			[]interface{}{EventTime(ts), map[string]interface{}{"a": 2}},
+		}})
+		So(err, ShouldEqual, nil)
+
+		pack := <-router
+		So(pack.Msg.Timestamp, ShouldEqual, 1420070400*int64(time.Second))
+		pack = <-router
+		So(pack.Msg.Timestamp, ShouldEqual, ts)
+		So(pack.Msg.Data["a"], ShouldEqual, 2)
+	})
+
+	Convey("Compressed PackedForward mode is acknowledged", t, func() {
+		var stream bytes.Buffer
+		codec.NewEncoder(&stream, h).Encode([]interface{}{EventTime(ts), map[string]interface{}{"a": 3}})
+
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(stream.Bytes())
+		w.Close()
+
+		err := enc.Encode([]interface{}{"test.forward", compressed.Bytes(),
+			map[string]interface{}{"compressed": "gzip", "chunk": "abc"}})
+		So(err, ShouldEqual, nil)
+
+		pack := <-router
+		So(pack.Msg.Timestamp, ShouldEqual, ts)
+		So(pack.Msg.Data["a"], ShouldEqual, 3)
+
+		var ack map[string]interface{}
+		err = codec.NewDecoder(conn, h).Decode(&ack)
+		So(err, ShouldEqual, nil)
+		So(ack["ack"], ShouldEqual, "abc")
+	})
+
+	Convey("EventTime survives an encoding round trip", t, func() {
+		var buf bytes.Buffer
+		err := codec.NewEncoder(&buf, h).Encode(EventTime(ts))
+		So(err, ShouldEqual, nil)
+		So(buf.Bytes()[:2], ShouldResemble, []byte{0xd7, eventTimeExtType})
+
+		var v interface{}
+		err = codec.NewDecoderBytes(buf.Bytes(), h).Decode(&v)
+		So(err, ShouldEqual, nil)
+		So(v, ShouldEqual, EventTime(ts))
+	})
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpPackTimeout is the time a request waits for free packs before it is
+// answered with 503, when the pipeline is saturated.
+const httpPackTimeout = time.Second
+
+type inputHttp struct {
+	listenAddr
+
+	bind               string
+	port               string
+	body_size_limit    int64
+	cors_allow_origins []string
+	add_remote_addr    bool
+	keep_time_key      bool
+
+	json    *codec.JsonHandle
+	msgpack *codec.MsgpackHandle
+}
+
+func (self *inputHttp) Init(cf map[string]string) error {
+	self.bind = "0.0.0.0"
+	self.port = "9880"
+	self.body_size_limit = 32 * 1024 * 1024
+
+	value := cf["bind"]
+	if len(value) > 0 {
+		self.bind = value
+	}
+
+	value = cf["port"]
+	if len(value) > 0 {
+		self.port = value
+	}
+
+	value = cf["body_size_limit"]
+	if len(value) > 0 {
+		body_size_limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		self.body_size_limit = body_size_limit
+	}
+
+	value = cf["cors_allow_origins"]
+	if len(value) > 0 {
+		self.cors_allow_origins = splitPaths(value)
+	}
+
+	value = cf["add_remote_addr"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.add_remote_addr = true
+		}
+	}
+
+	value = cf["keep_time_key"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.keep_time_key = true
+		}
+	}
+
+	self.json = &codec.JsonHandle{}
+	self.json.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	self.msgpack = newForwardCodec()
+
+	return nil
+}
+
+func (self *inputHttp) Run(runner InputRunner) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(self.bind, self.port))
+	if err != nil {
+		return err
+	}
+	self.listening(listener.Addr())
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			self.serve(runner, w, r)
+		}),
+	}
+	return server.Serve(listener)
+}
+
+// serve emits the events posted to /tag/path with the tag tag.path. The
+// body is a JSON or msgpack record, or an array of records, possibly gzip
+// compressed. The time of the events is the time query parameter, or else
+// the time field of each record, in seconds.
+func (self *inputHttp) serve(runner InputRunner, w http.ResponseWriter, r *http.Request) {
+	if !self.cors(w, r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == "OPTIONS" && len(self.cors_allow_origins) > 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tag := strings.Replace(strings.Trim(r.URL.Path, "/"), "/", ".", -1)
+	if len(tag) == 0 {
+		http.Error(w, "tag is missing from the path", http.StatusBadRequest)
+		return
+	}
+
+	var timestamp int64
+	value := r.URL.Query().Get("time")
+	if len(value) > 0 {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "invalid time "+value, http.StatusBadRequest)
+			return
+		}
+		timestamp = int64(seconds * float64(time.Second))
+	}
+
+	body, status, err := self.readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	records, err := self.decode(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(records) > cap(runner.InChan()) {
+		http.Error(w, "too many events in one request", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// the events of a request are emitted together or not at all
+	packs := make([]*PipelinePack, 0, len(records))
+	timeout := time.After(httpPackTimeout)
+	for len(packs) < len(records) {
+		select {
+		case pack := <-runner.InChan():
+			packs = append(packs, pack)
+		case <-timeout:
+			for _, pack := range packs {
+				pack.Recycle()
+			}
+			log.Println("http: pipeline saturated, remote:", r.RemoteAddr)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "pipeline saturated", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	now := time.Now().UnixNano()
+	for i, record := range records {
+		pack := packs[i]
+		pack.Msg.Tag = tag
+		pack.Msg.Timestamp = timestamp
+		pack.Msg.Data = record
+
+		if timestamp == 0 {
+			pack.Msg.Timestamp = now
+			if t, ok := toTimestamp(record["time"]); ok {
+				pack.Msg.Timestamp = t
+				if !self.keep_time_key {
+					delete(record, "time")
+				}
+			}
+		}
+
+		if self.add_remote_addr {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			record["REMOTE_ADDR"] = host
+		}
+
+		runner.RouterChan() <- pack
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// cors sets the CORS headers of the requests coming from the origins of
+// cors_allow_origins, and reports whether the origin of the request is
+// allowed.
+func (self *inputHttp) cors(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 || len(self.cors_allow_origins) == 0 {
+		return true
+	}
+
+	for _, allowed := range self.cors_allow_origins {
+		if allowed != "*" && allowed != origin {
+			continue
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding")
+		}
+		return true
+	}
+
+	return false
+}
+
+// readBody returns the body of the request, decompressed, or the status of
+// the error.
+func (self *inputHttp) readBody(r *http.Request) ([]byte, int, error) {
+	body, err := readLimited(r.Body, self.body_size_limit)
+	if err != nil {
+		return nil, http.StatusRequestEntityTooLarge, err
+	}
+
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return body, http.StatusOK, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	defer gz.Close()
+
+	body, err = readLimited(gz, self.body_size_limit)
+	if err != nil {
+		return nil, http.StatusRequestEntityTooLarge, err
+	}
+	return body, http.StatusOK, nil
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("body exceeds body_size_limit of %d bytes", limit)
+	}
+	return b, nil
+}
+
+// decode returns the records of a body, which is msgpack for the msgpack
+// content types and JSON otherwise. Form bodies hold them in a json or a
+// msgpack parameter.
+func (self *inputHttp) decode(contentType string, body []byte) ([]map[string]interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var handle codec.Handle = self.json
+	switch mediaType {
+	case "application/msgpack", "application/x-msgpack":
+		handle = self.msgpack
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+
+		if value := values.Get("msgpack"); len(value) > 0 {
+			handle = self.msgpack
+			body = []byte(value)
+		} else if value := values.Get("json"); len(value) > 0 {
+			body = []byte(value)
+		} else {
+			return nil, errors.New("json or msgpack parameter is required")
+		}
+	}
+
+	var value interface{}
+	err := codec.NewDecoderBytes(body, handle).Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		records := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid record %v", item)
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+
+	return nil, fmt.Errorf("invalid record %v", value)
+}
+
+func init() {
+	RegisterInput("http", func() interface{} {
+		return new(inputHttp)
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHttpInput(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	router, addr := startInput(t, new(inputHttp), map[string]string{
+		"bind":               "127.0.0.1",
+		"port":               "0",
+		"body_size_limit":    "1024",
+		"cors_allow_origins": "http://example.com",
+		"add_remote_addr":    "on",
+	}, 2)
+	base := "http://" + addr
+
+	Convey("A JSON record is tagged with the path", t, func() {
+		resp, err := http.Post(base+"/app/access?time=1500000000.5", "application/json", strings.NewReader(`{"status":200}`))
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "app.access")
+		So(pack.Msg.Timestamp, ShouldEqual, int64(1500000000500000000))
+		So(pack.Msg.Data["status"], ShouldEqual, 200)
+		So(pack.Msg.Data["REMOTE_ADDR"], ShouldEqual, "127.0.0.1")
+		pack.Recycle()
+	})
+
+	Convey("A gzip compressed batch takes the time of its records", t, func() {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		gz.Write([]byte(`[{"n":1,"time":1500000000},{"n":2}]`))
+		gz.Close()
+
+		req, _ := http.NewRequest("POST", base+"/batch", &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		pack := <-router
+		So(pack.Msg.Timestamp, ShouldEqual, int64(1500000000000000000))
+		So(pack.Msg.Data["time"], ShouldEqual, nil)
+		pack.Recycle()
+
+		pack = <-router
+		So(pack.Msg.Data["n"], ShouldEqual, 2)
+		So(pack.Msg.Timestamp, ShouldBeGreaterThan, int64(1500000000000000000))
+		pack.Recycle()
+	})
+
+	Convey("msgpack bodies and forms", t, func() {
+		var body []byte
+		codec.NewEncoderBytes(&body, newForwardCodec()).Encode(map[string]interface{}{"k": "v"})
+
+		resp, err := http.Post(base+"/mp", "application/msgpack", bytes.NewReader(body))
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		pack := <-router
+		So(pack.Msg.Data["k"], ShouldEqual, "v")
+		pack.Recycle()
+
+		resp, err = http.PostForm(base+"/form", url.Values{"json": {`{"k":"form"}`}})
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		pack = <-router
+		So(pack.Msg.Tag, ShouldEqual, "form")
+		So(pack.Msg.Data["k"], ShouldEqual, "form")
+		pack.Recycle()
+	})
+
+	Convey("Invalid requests are rejected", t, func() {
+		resp, _ := http.Get(base + "/app")
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 405)
+
+		resp, _ = http.Post(base+"/", "application/json", strings.NewReader(`{}`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		resp, _ = http.Post(base+"/app", "application/json", strings.NewReader(`[1]`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		resp, _ = http.Post(base+"/app", "application/json", strings.NewReader(`{"k":"`+strings.Repeat("x", 2000)+`"}`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 413)
+
+		resp, _ = http.Post(base+"/app", "application/json", strings.NewReader(`[{},{},{}]`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 413)
+	})
+
+	Convey("CORS", t, func() {
+		req, _ := http.NewRequest("OPTIONS", base+"/app", nil)
+		req.Header.Set("Origin", "http://example.com")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("Access-Control-Allow-Origin"), ShouldEqual, "http://example.com")
+
+		req, _ = http.NewRequest("POST", base+"/app", strings.NewReader(`{}`))
+		req.Header.Set("Origin", "http://evil.com")
+		resp, err = http.DefaultClient.Do(req)
+		So(err, ShouldEqual, nil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 403)
+	})
+
+	Convey("Requests are answered with 503 while the pipeline is saturated", t, func() {
+		resp, _ := http.Post(base+"/app", "application/json", strings.NewReader(`[{},{}]`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+
+		resp, _ = http.Post(base+"/app", "application/json", strings.NewReader(`{}`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 503)
+		So(resp.Header.Get("Retry-After"), ShouldEqual, "1")
+
+		(<-router).Recycle()
+		(<-router).Recycle()
+
+		resp, _ = http.Post(base+"/app", "application/json", strings.NewReader(`{}`))
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 200)
+		(<-router).Recycle()
+	})
+}
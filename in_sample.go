@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleTick is the longest time between two emissions of high rates.
+const sampleTick = 10 * time.Millisecond
+
+const sampleLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// sampleField is a field of the sample records set to a random value.
+type sampleField struct {
+	key     string
+	kind    string
+	n       int
+	choices []string
+}
+
+func (self *sampleField) value(random *rand.Rand) interface{} {
+	switch self.kind {
+	case "int":
+		return random.Intn(self.n)
+	case "float":
+		return random.Float64()
+	case "string":
+		b := make([]byte, self.n)
+		for i := range b {
+			b[i] = sampleLetters[random.Intn(len(sampleLetters))]
+		}
+		return string(b)
+	default:
+		return self.choices[random.Intn(len(self.choices))]
+	}
+}
+
+// parseSampleFields parses the random_fields specs key:int:N, key:float,
+// key:string:N and key:choice:a|b|c, separated by commas.
+func parseSampleFields(value string) ([]*sampleField, error) {
+	var fields []*sampleField
+	for _, spec := range splitPaths(value) {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid random field %s", spec)
+		}
+
+		field := &sampleField{key: parts[0], kind: parts[1]}
+		switch field.kind {
+		case "float":
+		case "int", "string":
+			if len(parts) < 3 {
+				return nil, fmt.Errorf("%s requires a size", spec)
+			}
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid size in %s", spec)
+			}
+			field.n = n
+		case "choice":
+			if len(parts) < 3 || len(parts[2]) == 0 {
+				return nil, fmt.Errorf("%s requires choices", spec)
+			}
+			field.choices = strings.Split(parts[2], "|")
+		default:
+			return nil, fmt.Errorf("unknown type of random field %s", spec)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+type inputSample struct {
+	tag                string
+	rate               int
+	size               int
+	samples            []map[string]interface{}
+	auto_increment_key string
+	random_fields      []*sampleField
+}
+
+func (self *inputSample) Init(cf map[string]string) error {
+	self.rate = 1
+	self.size = 1
+	self.samples = []map[string]interface{}{{"message": "sample"}}
+
+	value := cf["tag"]
+	if len(value) > 0 {
+		self.tag = value
+	} else {
+		return errors.New("tag is required")
+	}
+
+	value = cf["rate"]
+	if len(value) > 0 {
+		rate, err := strconv.Atoi(value)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("invalid rate %s", value)
+		}
+		self.rate = rate
+	}
+
+	value = cf["size"]
+	if len(value) > 0 {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid size %s", value)
+		}
+		self.size = size
+	}
+
+	value = cf["sample"]
+	if len(value) == 0 {
+		value = cf["dummy"]
+	}
+	if len(value) > 0 {
+		samples, err := decodeSamples(value)
+		if err != nil {
+			return err
+		}
+		self.samples = samples
+	}
+
+	value = cf["auto_increment_key"]
+	if len(value) > 0 {
+		self.auto_increment_key = value
+	}
+
+	value = cf["random_fields"]
+	if len(value) > 0 {
+		random_fields, err := parseSampleFields(value)
+		if err != nil {
+			return err
+		}
+		self.random_fields = random_fields
+	}
+
+	return nil
+}
+
+// decodeSamples returns the records of a JSON record or array of records.
+func decodeSamples(value string) ([]map[string]interface{}, error) {
+	handle := &codec.JsonHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	var sample interface{}
+	err := codec.NewDecoderBytes([]byte(value), handle).Decode(&sample)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := sample.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		samples := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			record, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid sample %v", item)
+			}
+			samples = append(samples, record)
+		}
+		if len(samples) > 0 {
+			return samples, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid sample %s", value)
+}
+
+// Run emits size events rate times per second. The sample records are
+// emitted in turn. When the pipeline is slower than the rate, the events
+// late are emitted as soon as possible.
+func (self *inputSample) Run(runner InputRunner) error {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	interval := time.Second / time.Duration(self.rate)
+	if interval < sampleTick {
+		interval = sampleTick
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var counter int64
+	var emitted int64
+	start := time.Now()
+	for {
+		due := int64(time.Since(start).Seconds() * float64(self.rate))
+		for ; emitted < due; emitted++ {
+			for i := 0; i < self.size; i++ {
+				self.emit(runner, random, counter)
+				counter++
+			}
+		}
+		<-tick.C
+	}
+}
+
+func (self *inputSample) emit(runner InputRunner, random *rand.Rand, counter int64) {
+	sample := self.samples[counter%int64(len(self.samples))]
+
+	record := copySample(sample).(map[string]interface{})
+	for _, field := range self.random_fields {
+		record[field.key] = field.value(random)
+	}
+	if len(self.auto_increment_key) > 0 {
+		record[self.auto_increment_key] = counter
+	}
+
+	pack := <-runner.InChan()
+	pack.Msg.Tag = self.tag
+	pack.Msg.Timestamp = time.Now().UnixNano()
+	pack.Msg.Data = record
+
+	runner.RouterChan() <- pack
+}
+
+// copySample returns a deep copy of a sample, as the filters may modify the
+// records emitted.
+func copySample(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = copySample(item)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, item := range v {
+			a[i] = copySample(item)
+		}
+		return a
+	}
+	return value
+}
+
+func init() {
+	RegisterInput("sample", func() interface{} {
+		return new(inputSample)
+	})
+	RegisterInput("dummy", func() interface{} {
+		return new(inputSample)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestSampleInput(t *testing.T) {
+	Convey("The samples are emitted in turn with random fields", t, func() {
+		router, _ := startInput(t, new(inputSample), map[string]string{
+			"tag":                "sample",
+			"rate":               "100",
+			"size":               "2",
+			"sample":             `[{"level":"info"},{"level":"warn","nested":{"k":1}}]`,
+			"auto_increment_key": "id",
+			"random_fields":      "user:int:10, payload:string:16, ratio:float, method:choice:GET|POST",
+		}, 10)
+
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			pack := <-router
+			So(pack.Msg.Tag, ShouldEqual, "sample")
+			So(pack.Msg.Data["id"], ShouldEqual, i)
+			if i%2 == 0 {
+				So(pack.Msg.Data["level"], ShouldEqual, "info")
+			} else {
+				So(pack.Msg.Data["level"], ShouldEqual, "warn")
+				nested := pack.Msg.Data["nested"].(map[string]interface{})
+				So(nested["k"], ShouldEqual, 1)
+				nested["k"] = 2
+			}
+			So(pack.Msg.Data["user"], ShouldBeBetweenOrEqual, 0, 9)
+			So(len(pack.Msg.Data["payload"].(string)), ShouldEqual, 16)
+			So(pack.Msg.Data["ratio"], ShouldBeLessThan, 1)
+			So(pack.Msg.Data["method"], ShouldBeIn, "GET", "POST")
+			pack.Recycle()
+		}
+
+		// 50 emissions of 2 events at 100 per second
+		So(time.Since(start), ShouldBeBetween, 400*time.Millisecond, 1500*time.Millisecond)
+	})
+
+	Convey("No more events than the rate are emitted", t, func() {
+		router, _ := startInput(t, new(inputSample), map[string]string{"tag": "rate", "rate": "50"}, 100)
+
+		start := time.Now()
+		timeout := time.After(time.Second)
+		count := 0
+	loop:
+		for {
+			select {
+			case pack := <-router:
+				pack.Recycle()
+				count++
+			case <-timeout:
+				break loop
+			}
+		}
+
+		So(count, ShouldBeLessThanOrEqualTo, int(time.Since(start).Seconds()*50))
+		So(count, ShouldBeGreaterThanOrEqualTo, 40)
+	})
+
+	Convey("The default sample", t, func() {
+		router, _ := startInput(t, new(inputSample), map[string]string{"tag": "dummy"}, 10)
+
+		pack := <-router
+		So(pack.Msg.Data, ShouldResemble, map[string]interface{}{"message": "sample"})
+	})
+
+	Convey("Invalid configurations", t, func() {
+		So(new(inputSample).Init(map[string]string{"tag": "t", "sample": "[1]"}), ShouldNotEqual, nil)
+		So(new(inputSample).Init(map[string]string{"tag": "t", "rate": "0"}), ShouldNotEqual, nil)
+		So(new(inputSample).Init(map[string]string{"tag": "t", "random_fields": "user:int"}), ShouldNotEqual, nil)
+		So(new(inputSample).Init(map[string]string{"tag": "t", "random_fields": "user:date:1"}), ShouldNotEqual, nil)
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// socketHostnamesLimit bounds the cache of the hostnames of the senders.
+const socketHostnamesLimit = 1024
+
+// socketSource is the part of the tcp and udp inputs turning the messages
+// received into events.
+type socketSource struct {
+	listenAddr
+
+	name               string
+	tag                string
+	section            map[string]string
+	parser             *RecordParser
+	source_host_key    string
+	source_address_key string
+
+	mu        sync.Mutex
+	hostnames map[string]string
+}
+
+func (self *socketSource) init(cf map[string]string) error {
+	value := cf["tag"]
+	if len(value) > 0 {
+		self.tag = value
+	} else {
+		return errors.New("tag is required")
+	}
+
+	section := ParseSection(cf)
+	if len(section["type"]) == 0 {
+		return errors.New("a <parse> section or format is required")
+	}
+
+	parser, err := NewRecordParser(section)
+	if err != nil {
+		return err
+	}
+	self.section = section
+	self.parser = parser
+
+	value = cf["source_host_key"]
+	if len(value) > 0 {
+		self.source_host_key = value
+	}
+
+	value = cf["source_address_key"]
+	if len(value) > 0 {
+		self.source_address_key = value
+	}
+
+	self.hostnames = make(map[string]string)
+	return nil
+}
+
+// emit routes the event parsed by parser from a message sent from addr. The
+// messages which can not be parsed are dropped.
+func (self *socketSource) emit(runner InputRunner, parser *RecordParser, text []byte, addr net.Addr) {
+	pack := <-runner.InChan()
+	pack.MsgBytes = append(pack.MsgBytes[:0], text...)
+	pack.Msg.Tag = self.tag
+	pack.Msg.Timestamp = time.Now().UnixNano()
+
+	err := parser.Parse(text, &pack.Msg)
+	if _, ok := err.(*TypeError); ok {
+		log.Println(self.name+": parser.Parse", err)
+		pack.Label = ErrorLabel
+	} else if err != nil {
+		log.Println(self.name+": parser.Parse", err, "remote:", addr)
+		pack.Recycle()
+		return
+	}
+
+	if len(self.source_address_key) > 0 || len(self.source_host_key) > 0 {
+		address := addressOf(addr)
+		if len(self.source_address_key) > 0 {
+			pack.Msg.Data[self.source_address_key] = address
+		}
+		if len(self.source_host_key) > 0 {
+			pack.Msg.Data[self.source_host_key] = self.hostname(address)
+		}
+	}
+
+	runner.RouterChan() <- pack
+}
+
+// addressOf returns the IP address of addr, or its path for unix sockets.
+func addressOf(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// hostname returns the name of address from a reverse lookup, or address
+// itself when it has none. The names are cached, as the lookups are slow.
+func (self *socketSource) hostname(address string) string {
+	self.mu.Lock()
+	name, ok := self.hostnames[address]
+	self.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	name = address
+	names, err := net.LookupAddr(address)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	self.mu.Lock()
+	if len(self.hostnames) >= socketHostnamesLimit {
+		self.hostnames = make(map[string]string)
+	}
+	self.hostnames[address] = name
+	self.mu.Unlock()
+	return name
+}
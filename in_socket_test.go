@@ -0,0 +1,15 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+)
+
+func TestSocketAddress(t *testing.T) {
+	Convey("The address of a sender is its IP", t, func() {
+		So(addressOf(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5170}), ShouldEqual, "10.0.0.1")
+		So(addressOf(&net.UDPAddr{IP: net.ParseIP("::1"), Port: 5160}), ShouldEqual, "::1")
+		So(addressOf(&net.UnixAddr{Name: "/dev/log", Net: "unixgram"}), ShouldEqual, "/dev/log")
+	})
+}
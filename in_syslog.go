@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "at",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warn", "notice", "info", "debug",
+}
+
+const (
+	// syslogDefaultPriority is the priority of the messages without one,
+	// user.notice.
+	syslogDefaultPriority = 13
+	// syslogMaxLength bounds the length of octet counted messages.
+	syslogMaxLength = 1024 * 1024
+)
+
+// listenAddr publishes the address an input listens to once it is bound,
+// e.g. the port chosen for port 0.
+type listenAddr struct {
+	once  sync.Once
+	ready chan net.Addr
+}
+
+func (self *listenAddr) addrChan() chan net.Addr {
+	self.once.Do(func() {
+		self.ready = make(chan net.Addr, 1)
+	})
+	return self.ready
+}
+
+func (self *listenAddr) listening(addr net.Addr) {
+	self.addrChan() <- addr
+}
+
+// Addr receives the address the input listens to, once.
+func (self *listenAddr) Addr() <-chan net.Addr {
+	return self.addrChan()
+}
+
+type inputSyslog struct {
+	listenAddr
+
+	tag           string
+	bind          string
+	port          string
+	path          string
+	protocol_type string
+	tls_config    *tls.Config
+
+	section              map[string]string
+	parser               *RecordParser
+	emit_unmatched_lines bool
+	priority_key         string
+	facility_key         string
+	severity_key         string
+}
+
+func (self *inputSyslog) Init(cf map[string]string) error {
+	self.bind = "0.0.0.0"
+	self.port = "5140"
+	self.protocol_type = "udp"
+
+	value := cf["tag"]
+	if len(value) > 0 {
+		self.tag = value
+	} else {
+		return errors.New("tag is required")
+	}
+
+	value = cf["bind"]
+	if len(value) > 0 {
+		self.bind = value
+	}
+
+	value = cf["port"]
+	if len(value) > 0 {
+		self.port = value
+	}
+
+	value = cf["protocol_type"]
+	if len(value) > 0 {
+		switch value {
+		case "udp", "tcp", "unix", "unixgram":
+			self.protocol_type = value
+		default:
+			return fmt.Errorf("unknown protocol_type %s", value)
+		}
+	}
+
+	value = cf["path"]
+	if len(value) > 0 {
+		self.path = value
+	} else if self.protocol_type == "unix" || self.protocol_type == "unixgram" {
+		return errors.New("path is required by unix sockets")
+	}
+
+	value = cf["tls"]
+	if len(value) > 0 {
+		if value == "on" {
+			if self.protocol_type != "tcp" {
+				return errors.New("tls requires protocol_type tcp")
+			}
+
+			tls_config, err := newTLSConfig(cf)
+			if err != nil {
+				return err
+			}
+			self.tls_config = tls_config
+		}
+	}
+
+	section := ParseSection(cf)
+	if len(section["type"]) == 0 {
+		section["type"] = "syslog"
+	}
+
+	parser, err := NewRecordParser(section)
+	if err != nil {
+		return err
+	}
+	self.section = section
+	self.parser = parser
+
+	value = cf["emit_unmatched_lines"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.emit_unmatched_lines = true
+		}
+	}
+
+	value = cf["priority_key"]
+	if len(value) > 0 {
+		self.priority_key = value
+	}
+
+	value = cf["facility_key"]
+	if len(value) > 0 {
+		self.facility_key = value
+	}
+
+	value = cf["severity_key"]
+	if len(value) > 0 {
+		self.severity_key = value
+	}
+
+	return nil
+}
+
+// newTLSConfig loads the certificate of a server from tls_cert_path and
+// tls_private_key_path. With tls_ca_path, the clients must present a
+// certificate signed by these CAs.
+func newTLSConfig(cf map[string]string) (*tls.Config, error) {
+	if len(cf["tls_cert_path"]) == 0 || len(cf["tls_private_key_path"]) == 0 {
+		return nil, errors.New("tls_cert_path and tls_private_key_path are required by tls")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cf["tls_cert_path"], cf["tls_private_key_path"])
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	value := cf["tls_ca_path"]
+	if len(value) > 0 {
+		pem, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", value)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func (self *inputSyslog) Run(runner InputRunner) error {
+	switch self.protocol_type {
+	case "udp":
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(self.bind, self.port))
+		if err != nil {
+			return err
+		}
+		return self.serveDatagrams(runner, conn)
+	case "unixgram":
+		os.Remove(self.path)
+		conn, err := net.ListenPacket("unixgram", self.path)
+		if err != nil {
+			return err
+		}
+		return self.serveDatagrams(runner, conn)
+	case "unix":
+		os.Remove(self.path)
+		listener, err := net.Listen("unix", self.path)
+		if err != nil {
+			return err
+		}
+		return self.serveStreams(runner, listener)
+	default:
+		listener, err := net.Listen("tcp", net.JoinHostPort(self.bind, self.port))
+		if err != nil {
+			return err
+		}
+		if self.tls_config != nil {
+			listener = tls.NewListener(listener, self.tls_config)
+		}
+		return self.serveStreams(runner, listener)
+	}
+}
+
+// serveDatagrams emits each datagram as one message.
+func (self *inputSyslog) serveDatagrams(runner InputRunner, conn net.PacketConn) error {
+	defer conn.Close()
+	self.listening(conn.LocalAddr())
+
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Println("syslog: read failed:", err)
+				continue
+			}
+			return err
+		}
+
+		self.emit(runner, self.parser, bytes.TrimRight(buf[:n], "\r\n"))
+	}
+}
+
+func (self *inputSyslog) serveStreams(runner InputRunner, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer listener.Close()
+	self.listening(listener.Addr())
+
+	var err error
+	for {
+		var conn net.Conn
+		if conn, err = listener.Accept(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Println("syslog: accept failed:", err)
+				continue
+			}
+			break
+		}
+
+		wg.Add(1)
+
+		go self.handleConn(runner, conn, &wg)
+	}
+
+	wg.Wait()
+	return err
+}
+
+// handleConn reads the messages of a connection, with its own parser as
+// the connections are read concurrently.
+func (self *inputSyslog) handleConn(runner InputRunner, conn net.Conn, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer conn.Close()
+
+	parser, err := NewRecordParser(self.section)
+	if err != nil {
+		log.Println("syslog: NewRecordParser", err)
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readSyslogFrame(reader)
+		if len(frame) > 0 {
+			self.emit(runner, parser, frame)
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				log.Println("syslog: read failed, remote:", conn.RemoteAddr(), "err:", err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame returns the next message of a stream. A message starting
+// with digits, a space and the < of its priority is octet counted, i.e.
+// prefixed by its length and a space, as described by RFC 6587. The other
+// ones end with a newline, e.g. the RFC 5424 messages without priority,
+// which start with the version 1 and a space.
+func readSyslogFrame(reader *bufio.Reader) ([]byte, error) {
+	_, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if octetCounted(reader) {
+		prefix, err := reader.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(prefix[:len(prefix)-1])
+		if err != nil || length < 0 || length > syslogMaxLength {
+			return nil, fmt.Errorf("invalid message length %q", prefix)
+		}
+
+		frame := make([]byte, length)
+		_, err = io.ReadFull(reader, frame)
+		return bytes.TrimRight(frame, "\r\n"), err
+	}
+
+	frame, err := reader.ReadBytes('\n')
+	if err == io.EOF && len(frame) > 0 {
+		err = nil
+	}
+	return bytes.TrimRight(frame, "\r\n"), err
+}
+
+// octetCounted reports whether the next message of reader starts with the
+// length of an octet counted message. The bytes after the length are only
+// waited for when they can be a priority.
+func octetCounted(reader *bufio.Reader) bool {
+	digits := len(strconv.Itoa(syslogMaxLength))
+	for i := 1; i <= digits+1; i++ {
+		b, err := reader.Peek(i)
+		if err != nil {
+			return false
+		}
+
+		c := b[i-1]
+		if c == ' ' && i > 1 {
+			b, err = reader.Peek(i + 1)
+			return err == nil && b[i] == '<'
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return false
+}
+
+// splitSyslogPriority returns the priority of a message, and the message
+// after it.
+func splitSyslogPriority(text []byte) (int, []byte) {
+	if len(text) > 2 && text[0] == '<' {
+		end := bytes.IndexByte(text, '>')
+		if end > 1 && end <= 4 {
+			pri, err := strconv.Atoi(string(text[1:end]))
+			if err == nil && pri < len(syslogFacilities)*8 {
+				return pri, text[end+1:]
+			}
+		}
+	}
+	return syslogDefaultPriority, text
+}
+
+// emit routes a message with the tag prefix.facility.severity. The messages
+// which can not be parsed are dropped, or emitted with the tag
+// prefix.unmatched when emit_unmatched_lines is on.
+func (self *inputSyslog) emit(runner InputRunner, parser *RecordParser, text []byte) {
+	pri, body := splitSyslogPriority(text)
+	facility := syslogFacilities[pri/8]
+	severity := syslogSeverities[pri%8]
+
+	pack := <-runner.InChan()
+	pack.MsgBytes = append(pack.MsgBytes[:0], text...)
+	pack.Msg.Tag = self.tag + "." + facility + "." + severity
+	pack.Msg.Timestamp = time.Now().UnixNano()
+
+	err := parser.Parse(body, &pack.Msg)
+	if _, ok := err.(*TypeError); ok {
+		log.Println("syslog: parser.Parse", err)
+		pack.Label = ErrorLabel
+	} else if err != nil {
+		if !self.emit_unmatched_lines {
+			log.Println("syslog: parser.Parse", err)
+			pack.Recycle()
+			return
+		}
+
+		pack.Msg.Tag = self.tag + ".unmatched"
+		pack.Msg.Data = map[string]interface{}{"unmatched_line": string(text)}
+		runner.RouterChan() <- pack
+		return
+	}
+
+	if len(self.priority_key) > 0 {
+		pack.Msg.Data[self.priority_key] = pri
+	}
+	if len(self.facility_key) > 0 {
+		pack.Msg.Data[self.facility_key] = facility
+	}
+	if len(self.severity_key) > 0 {
+		pack.Msg.Data[self.severity_key] = severity
+	}
+
+	runner.RouterChan() <- pack
+}
+
+func init() {
+	RegisterInput("syslog", func() interface{} {
+		return new(inputSyslog)
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// startInput runs an input with a pool of pool packs. It returns the channel
+// of its events, and the address it listens to once it is bound, if any.
+func startInput(t *testing.T, input Input, cf map[string]string, pool int) (chan *PipelinePack, string) {
+	err := input.Init(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := make(chan *PipelinePack, 10)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- input.Run(NewInputRunner(NewPipelinePackPool(pool), router))
+	}()
+
+	listener, ok := input.(interface {
+		Addr() <-chan net.Addr
+	})
+	if !ok {
+		return router, ""
+	}
+
+	select {
+	case addr := <-listener.Addr():
+		return router, addr.String()
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the input is not listening")
+	}
+	return nil, ""
+}
+
+// writeCertificate writes a self-signed certificate of 127.0.0.1 and its key.
+func writeCertificate(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+func TestSyslogInput(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("UDP messages are tagged with their facility and severity", t, func() {
+		router, addr := startInput(t, new(inputSyslog), map[string]string{
+			"tag":          "syslog",
+			"bind":         "127.0.0.1",
+			"port":         "0",
+			"facility_key": "facility",
+			"utc":          "on",
+		}, 10)
+
+		conn, err := net.Dial("udp", addr)
+		So(err, ShouldEqual, nil)
+		defer conn.Close()
+
+		conn.Write([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8\n"))
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "syslog.auth.crit")
+		So(pack.Msg.Data["host"], ShouldEqual, "mymachine")
+		So(pack.Msg.Data["ident"], ShouldEqual, "su")
+		So(pack.Msg.Data["pid"], ShouldEqual, "123")
+		So(pack.Msg.Data["message"], ShouldEqual, "'su root' failed for lonvick on /dev/pts/8")
+		So(pack.Msg.Data["facility"], ShouldEqual, "auth")
+		So(time.Unix(0, pack.Msg.Timestamp).UTC().Format("01-02 15:04:05"), ShouldEqual, "10-11 22:14:15")
+	})
+
+	Convey("TCP messages are octet counted or newline delimited", t, func() {
+		router, addr := startInput(t, new(inputSyslog), map[string]string{
+			"tag":                  "syslog",
+			"bind":                 "127.0.0.1",
+			"port":                 "0",
+			"protocol_type":        "tcp",
+			"message_format":       "auto",
+			"emit_unmatched_lines": "on",
+		}, 10)
+
+		conn, err := net.Dial("tcp", addr)
+		So(err, ShouldEqual, nil)
+		defer conn.Close()
+
+		rfc5424 := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event log entry...`
+		conn.Write([]byte(fmt.Sprintf("%d %s", len(rfc5424), rfc5424)))
+		conn.Write([]byte("<13>Oct 11 22:14:15 host app: multi\nline\n"))
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "syslog.local4.notice")
+		So(pack.Msg.Data["msgid"], ShouldEqual, "ID47")
+		So(pack.Msg.Data["message"], ShouldEqual, "An application event log entry...")
+
+		pack = <-router
+		So(pack.Msg.Tag, ShouldEqual, "syslog.user.notice")
+		So(pack.Msg.Data["message"], ShouldEqual, "multi")
+
+		pack = <-router
+		So(pack.Msg.Tag, ShouldEqual, "syslog.unmatched")
+		So(pack.Msg.Data["unmatched_line"], ShouldEqual, "line")
+
+		// an RFC 5424 message without priority starts with its version
+		conn.Write([]byte("1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID48 - no priority\n"))
+		pack = <-router
+		So(pack.Msg.Tag, ShouldEqual, "syslog.user.notice")
+		So(pack.Msg.Data["msgid"], ShouldEqual, "ID48")
+		So(pack.Msg.Data["message"], ShouldEqual, "no priority")
+	})
+
+	Convey("Connections are parsed concurrently", t, func() {
+		router, addr := startInput(t, new(inputSyslog), map[string]string{
+			"tag":           "syslog",
+			"bind":          "127.0.0.1",
+			"port":          "0",
+			"protocol_type": "tcp",
+		}, 10)
+
+		for i := 0; i < 2; i++ {
+			go func() {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				for j := 0; j < 20; j++ {
+					conn.Write([]byte("<13>Oct 11 22:14:15 host app: message\n"))
+				}
+			}()
+		}
+
+		for i := 0; i < 40; i++ {
+			pack := <-router
+			So(pack.Msg.Data["message"], ShouldEqual, "message")
+			pack.Recycle()
+		}
+	})
+
+	Convey("Unix datagram sockets", t, func() {
+		path := "/tmp/gofluent-syslog.sock"
+		defer os.Remove(path)
+		router, _ := startInput(t, new(inputSyslog), map[string]string{"tag": "local", "protocol_type": "unixgram", "path": path}, 10)
+
+		conn, err := net.Dial("unixgram", path)
+		So(err, ShouldEqual, nil)
+		defer conn.Close()
+
+		conn.Write([]byte("<30>Oct 11 22:14:15 host app: started"))
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "local.daemon.info")
+		So(pack.Msg.Data["message"], ShouldEqual, "started")
+	})
+
+	Convey("TLS", t, func() {
+		dir := "/tmp/gofluent-syslog-tls"
+		os.MkdirAll(dir, 0755)
+		defer os.RemoveAll(dir)
+		So(writeCertificate(dir+"/cert.pem", dir+"/key.pem"), ShouldEqual, nil)
+
+		_, err := newTLSConfig(map[string]string{"tls_cert_path": dir + "/cert.pem"})
+		So(err, ShouldNotEqual, nil)
+
+		router, addr := startInput(t, new(inputSyslog), map[string]string{
+			"tag":                  "secure",
+			"bind":                 "127.0.0.1",
+			"port":                 "0",
+			"protocol_type":        "tcp",
+			"tls":                  "on",
+			"tls_cert_path":        dir + "/cert.pem",
+			"tls_private_key_path": dir + "/key.pem",
+		}, 10)
+
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		So(err, ShouldEqual, nil)
+		defer conn.Close()
+
+		conn.Write([]byte("<38>Oct 11 22:14:15 host sshd: accepted\n"))
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "secure.auth.info")
+		So(pack.Msg.Data["ident"], ShouldEqual, "sshd")
+	})
+}
@@ -1,54 +1,178 @@
 package main
 
 import (
-	"github.com/ActiveState/tail"
-	"github.com/ugorji/go/codec"
-	"io/ioutil"
+	"bufio"
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"reflect"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// tailPollInterval is the interval of the checks for new content once
+	// the end of a file is reached, when the file is not watched.
+	tailPollInterval = 250 * time.Millisecond
+	// tailWatchInterval is the interval of the checks of watched files, in
+	// case an inotify event is missed, e.g. on network filesystems.
+	tailWatchInterval = time.Second
+)
+
+// tailMetrics counts the lines skipped and truncated by max_line_size, and
+// the NUL bytes of padded files, of all the tail sources. They are served at
+// /debug/vars with the profiling server.
+var tailMetrics = expvar.NewMap("in_tail")
+
 type inputTail struct {
-	path     string
-	format   string
-	tag      string
-	pos_file string
+	paths         []string
+	exclude_paths []string
+	tag           string
+	pos_file      string
+	path_key      string
+
+	refresh_interval        int
+	limit_recently_modified int
+	sync_interval           int
+	parser                  *RecordParser
+
+	firstline                *regexp.Regexp
+	multiline_rule           multilineRule
+	multiline_flush_interval int
+
+	enable_stat_watcher         bool
+	read_lines_limit            int
+	read_bytes_limit_per_second int64
+	rotate_wait                 int
+	read_archives               bool
+	line_limit                  lineLimit
+	read_from_head              bool
+	read_from_time              time.Time
+
+	positions *positionFile
+	watcher   *tailWatcher
+	tailers   map[string]*fileTailer
+	batches   chan *tailBatch
+
+	// archives are the compressed files matched by the paths
+	archives map[string]bool
+}
 
-	offset        int64
-	sync_interval int
-	codec         *codec.JsonHandle
-	time_key      string
+// fileTailer follows one of the files matched by the paths of the source.
+type fileTailer struct {
+	path      string
+	reader    *tailReader
+	multiline *multilineBuffer
+	done      chan bool
+
+	// notify receives the changes of the file when watched is set
+	notify  chan bool
+	watched bool
+
+	read_lines_limit int
+	read_bytes_limit int64
+	rotate_wait      time.Duration
+	line_limit       lineLimit
+	window           time.Time
+	window_bytes     int64
+
+	// offset and inode are the position after the last line received
+	offset int64
+	inode  uint64
+}
+
+// tailBatch holds the lines read at once from a file.
+type tailBatch struct {
+	tailer *fileTailer
+	lines  []string
+	bytes  int64
+	time   time.Time
+
+	// offset and inode are the position after the last line
+	offset int64
+	inode  uint64
+
+	// detached lines are read from a rotated file or an archive, and leave
+	// the position of the tailer unchanged
+	detached bool
+	// archived is set on the last batch of an archive
+	archived bool
 }
 
 func (self *inputTail) Init(f map[string]string) error {
 
 	self.sync_interval = 2
+	self.refresh_interval = 60
+	self.enable_stat_watcher = true
+	self.read_lines_limit = 1000
+	self.rotate_wait = 5
+	self.positions = &positionFile{entries: make(map[string]*positionEntry)}
 
 	value := f["path"]
 	if len(value) > 0 {
-		self.path = value
+		self.paths = splitPaths(value)
 	}
 
-	value = f["format"]
+	value = f["exclude_path"]
 	if len(value) > 0 {
-		self.format = value
-		if value == "json" {
-			_codec := codec.JsonHandle{}
-			_codec.MapType = reflect.TypeOf(map[string]interface{}(nil))
-			self.codec = &_codec
+		self.exclude_paths = splitPaths(value)
+	}
 
-			value = f["time_key"]
-			if len(value) > 0 {
-				self.time_key = value
-			} else {
-				self.time_key = "time"
-			}
+	// the encodings may be set on the source, as with fluentd, or in the
+	// <parse> section
+	section := ParseSection(f)
+	for _, key := range []string{"from_encoding", "encoding", "invalid_bytes", "replace_char"} {
+		if _, ok := section[key]; !ok && len(f[key]) > 0 {
+			section[key] = f[key]
+		}
+	}
+
+	parser, err := NewRecordParser(section)
+	if err != nil {
+		return err
+	}
+	self.parser = parser
+
+	self.multiline_flush_interval = 5
+
+	value = section["format_firstline"]
+	if len(value) > 0 {
+		firstline, err := compileRegexp(value)
+		if err != nil {
+			return err
 		}
+		self.firstline = firstline
+	} else if section["type"] == "multiline" {
+		return fmt.Errorf("format_firstline is required by the multiline format")
+	}
+
+	value = f["multiline_mode"]
+	if len(value) > 0 {
+		rule, ok := multilineModes[value]
+		if !ok {
+			return fmt.Errorf("unknown multiline_mode %s", value)
+		}
+		if self.firstline != nil {
+			return fmt.Errorf("multiline_mode can not be combined with format_firstline")
+		}
+		self.multiline_rule = rule
+	}
+
+	value = f["multiline_flush_interval"]
+	if len(value) > 0 {
+		multiline_flush_interval, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if multiline_flush_interval <= 0 {
+			return fmt.Errorf("multiline_flush_interval must be positive")
+		}
+		self.multiline_flush_interval = multiline_flush_interval
 	}
 
 	value = f["tag"]
@@ -56,32 +180,126 @@ func (self *inputTail) Init(f map[string]string) error {
 		self.tag = value
 	}
 
+	value = f["path_key"]
+	if len(value) > 0 {
+		self.path_key = value
+	}
+
+	value = f["refresh_interval"]
+	if len(value) > 0 {
+		refresh_interval, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if refresh_interval <= 0 {
+			return fmt.Errorf("refresh_interval must be positive")
+		}
+		self.refresh_interval = refresh_interval
+	}
+
+	value = f["limit_recently_modified"]
+	if len(value) > 0 {
+		limit_recently_modified, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.limit_recently_modified = limit_recently_modified
+	}
+
 	value = f["pos_file"]
 	if len(value) > 0 {
 		self.pos_file = value
 
-		str, err := ioutil.ReadFile(self.pos_file)
+		var single string
+		if len(self.paths) == 1 {
+			single = self.paths[0]
+		}
+
+		var err error
+		self.positions, err = loadPositionFile(value, single)
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("tail: failed to load", self.pos_file, "err:", err)
+		}
+	}
+
+	value = f["enable_stat_watcher"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.enable_stat_watcher = false
+		}
+	}
+
+	value = f["read_lines_limit"]
+	if len(value) > 0 {
+		read_lines_limit, err := strconv.Atoi(value)
 		if err != nil {
-			log.Println("ioutil.ReadFile:", err)
+			return err
 		}
+		if read_lines_limit <= 0 {
+			return fmt.Errorf("read_lines_limit must be positive")
+		}
+		self.read_lines_limit = read_lines_limit
+	}
 
-		f, err := os.Open(self.path)
+	value = f["read_bytes_limit_per_second"]
+	if len(value) > 0 {
+		read_bytes_limit_per_second, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			log.Println("os.Open:", err)
+			return err
 		}
+		self.read_bytes_limit_per_second = read_bytes_limit_per_second
+	}
 
-		info, err := f.Stat()
+	value = f["rotate_wait"]
+	if len(value) > 0 {
+		rotate_wait, err := strconv.Atoi(value)
 		if err != nil {
-			log.Println("f.Stat:", err)
-			self.offset = 0
-		} else {
-			offset, _ := strconv.Atoi(string(str))
-			if int64(offset) > info.Size() {
-				self.offset = info.Size()
-			} else {
-				self.offset = int64(offset)
-			}
+			return err
 		}
+		self.rotate_wait = rotate_wait
+	}
+
+	value = f["read_archives"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.read_archives = true
+		}
+	}
+
+	value = f["max_line_size"]
+	if len(value) > 0 {
+		max_line_size, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.line_limit.max_line_size = max_line_size
+	}
+
+	value = f["max_line_size_action"]
+	if len(value) > 0 {
+		switch value {
+		case "skip":
+		case "truncate":
+			self.line_limit.truncate = true
+		default:
+			return fmt.Errorf("max_line_size_action must be skip or truncate")
+		}
+	}
+
+	value = f["read_from_head"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.read_from_head = true
+		}
+	}
+
+	value = f["read_from_time"]
+	if len(value) > 0 {
+		read_from_time, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		self.read_from_time = read_from_time
 	}
 
 	value = f["sync_interval"]
@@ -96,6 +314,17 @@ func (self *inputTail) Init(f map[string]string) error {
 	return nil
 }
 
+func splitPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 func (self *inputTail) Run(runner InputRunner) error {
 	defer func() {
 		if err := recover(); err != nil {
@@ -103,124 +332,508 @@ func (self *inputTail) Run(runner InputRunner) error {
 		}
 	}()
 
-	var seek int
-	if self.offset > 0 {
-		seek = os.SEEK_SET
-	} else {
-		seek = os.SEEK_END
-	}
-
-	t, err := tail.TailFile(self.path, tail.Config{
-		Poll:      true,
-		ReOpen:    true,
-		Follow:    true,
-		MustExist: false,
-		Location:  &tail.SeekInfo{int64(self.offset), seek}})
-	if err != nil {
-		return err
+	self.tailers = make(map[string]*fileTailer)
+	self.archives = make(map[string]bool)
+	self.batches = make(chan *tailBatch)
+	if self.enable_stat_watcher {
+		self.watcher = newTailWatcher()
 	}
 
-	f, err := os.OpenFile(self.pos_file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		log.Fatalln("os.OpenFile", err)
-	}
-	defer f.Close()
+	count := self.refresh(runner, true)
 
-	var re regexp.Regexp
-	if string(self.format[0]) == string("/") || string(self.format[len(self.format)-1]) == string("/") {
-		format := strings.Trim(self.format, "/")
-		trueformat := regexp.MustCompile("\\(\\?<").ReplaceAllString(format, "(?P<")
-		if trueformat != format {
-			log.Printf("pos_file:%s, format:%s", self.path, trueformat)
-		}
-		re = *regexp.MustCompile(trueformat)
-		self.format = "regexp"
-	} else if self.format == "json" {
+	refresh := time.NewTicker(time.Second * time.Duration(self.refresh_interval))
+	tick := time.NewTicker(time.Second * time.Duration(self.sync_interval))
 
+	flush_interval := time.Second * time.Duration(self.multiline_flush_interval)
+	flush := time.NewTicker(flush_interval / 2)
+	if self.firstline == nil && self.multiline_rule == nil {
+		flush.Stop()
 	}
 
-	tick := time.NewTicker(time.Second * time.Duration(self.sync_interval))
-	count := 0
-
 	for {
 		select {
+		case <-refresh.C:
+			{
+				count += self.refresh(runner, false)
+			}
 		case <-tick.C:
 			{
-				if count > 0 {
-					offset, err := t.Tell()
+				if count > 0 && len(self.pos_file) > 0 {
+					err := self.savePositions()
 					if err != nil {
-						log.Println("Tell return error: ", err)
+						log.Println("tail: failed to save", self.pos_file, "err:", err)
 						continue
 					}
 
-					str := strconv.Itoa(int(offset))
-
-					_, err = f.WriteAt([]byte(str), 0)
-					if err != nil {
-						log.Println("f.WriteAt", err)
-						return err
-					}
-
 					count = 0
 				}
 			}
-		case line := <-t.Lines:
+		case <-flush.C:
 			{
-				pack := <-runner.InChan()
-
-				pack.MsgBytes = []byte(line.Text)
-				pack.Msg.Tag = self.tag
-				pack.Msg.Timestamp = line.Time.Unix()
+				// the last event of a multiline log is emitted once no
+				// line followed it for multiline_flush_interval
+				now := time.Now()
+				for _, tailer := range self.tailers {
+					if tailer.multiline.Expired(now, flush_interval) {
+						text, at, _ := tailer.multiline.Flush()
+						self.emit(runner, tailer.path, text, at)
+					}
+				}
+			}
+		case batch := <-self.batches:
+			{
+				count++
+				tailer := batch.tailer
+				if !batch.detached {
+					tailer.offset = batch.offset
+					tailer.inode = batch.inode
+				}
 
-				if self.format == "regexp" {
-					text := re.FindSubmatch([]byte(line.Text))
-					if text == nil {
-						pack.Recycle()
+				for _, line := range batch.lines {
+					if tailer.multiline == nil {
+						self.emit(runner, tailer.path, line, batch.time)
 						continue
 					}
 
-					for i, name := range re.SubexpNames() {
-						if len(name) > 0 {
-							pack.Msg.Data[name] = string(text[i])
-						}
+					text, at, ok := tailer.multiline.Push(line, batch.time)
+					if ok {
+						self.emit(runner, tailer.path, text, at)
 					}
-				} else if self.format == "json" {
-					dec := codec.NewDecoderBytes([]byte(line.Text), self.codec)
-					err := dec.Decode(&pack.Msg.Data)
-					if err != nil {
-						log.Println("json.Unmarshal", err)
-						pack.Recycle()
-						continue
-					} else {
-						t, ok := pack.Msg.Data[self.time_key]
-						if ok {
-							if time, xx := t.(uint64); xx {
-								pack.Msg.Timestamp = int64(time)
-								delete(pack.Msg.Data, self.time_key)
-							} else if time64, oo := t.(int64); oo {
-								pack.Msg.Timestamp = time64
-								delete(pack.Msg.Data, self.time_key)
-							} else {
-								log.Println("time is not int64, ", t, " typeof:", reflect.TypeOf(t))
-								pack.Recycle()
-								continue
-							}
+				}
+
+				if batch.archived {
+					if tailer.multiline != nil {
+						if text, at, ok := tailer.multiline.Flush(); ok {
+							self.emit(runner, tailer.path, text, at)
 						}
 					}
+					self.positions.Update(tailer.path, batch.offset, batch.inode)
 				}
+			}
+		}
+	}
+}
 
-				count++
-				runner.RouterChan() <- pack
+// refresh starts a tailer for each file newly matched by the paths, and
+// stops the tailers of the files no longer matched. The files found at
+// startup are read from their position. Without one, they are read from
+// read_from_time, from their head with read_from_head, or else from their
+// end. The files created later are read from their head. Compressed files
+// are handled by archive. It returns the number of tailers started and
+// stopped.
+func (self *inputTail) refresh(runner InputRunner, startup bool) int {
+	paths := self.expandPaths(time.Now())
+	changed := 0
+
+	for path := range paths {
+		if _, ok := self.tailers[path]; ok {
+			continue
+		}
+
+		if isArchive(path) {
+			changed += self.archive(path, startup)
+			continue
+		}
+
+		reader := newTailReader(path)
+		reader.limit = self.line_limit
+		if entry, ok := self.positions.Get(path); ok {
+			reader.Resume(entry.offset, entry.inode)
+		} else if startup && !self.read_from_time.IsZero() {
+			offset, err := self.searchTime(path, self.read_from_time)
+			if err != nil && !os.IsNotExist(err) {
+				log.Println("tail: failed to search", path, "err:", err)
 			}
+			reader.Resume(offset, 0)
+		} else if startup && !self.read_from_head {
+			reader.SeekEnd()
+		}
+
+		err := reader.open()
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("tail: failed to open", path, "err:", err)
 		}
+
+		tailer := self.newTailer(path)
+		tailer.reader = reader
+		tailer.offset, tailer.inode = reader.Position()
+		if self.watcher != nil {
+			tailer.watched = self.watcher.Add(path, tailer.notify)
+		}
+		self.tailers[path] = tailer
+		changed++
+
+		go tailer.forward(self.batches)
+	}
+
+	for path := range self.archives {
+		if !paths[path] {
+			delete(self.archives, path)
+		}
+	}
+
+	for path, tailer := range self.tailers {
+		if paths[path] {
+			continue
+		}
+
+		close(tailer.done)
+		delete(self.tailers, path)
+		if self.watcher != nil {
+			self.watcher.Remove(path)
+		}
+		changed++
+
+		if tailer.multiline != nil {
+			if text, at, ok := tailer.multiline.Flush(); ok {
+				self.emit(runner, path, text, at)
+			}
+		}
+	}
+
+	return changed
+}
+
+func (self *inputTail) newTailer(path string) *fileTailer {
+	tailer := &fileTailer{
+		path:             path,
+		done:             make(chan bool),
+		notify:           make(chan bool, 1),
+		read_lines_limit: self.read_lines_limit,
+		read_bytes_limit: self.read_bytes_limit_per_second,
+		rotate_wait:      time.Second * time.Duration(self.rotate_wait),
+		line_limit:       self.line_limit,
+	}
+	if self.firstline != nil || self.multiline_rule != nil {
+		tailer.multiline = &multilineBuffer{firstline: self.firstline, rule: self.multiline_rule}
+	}
+	return tailer
+}
+
+// archive handles a compressed file matched by the paths. With
+// read_archives, the archives found at startup and not recorded in the pos
+// file are read once, and recorded when fully read. The archives created
+// later are recorded without being read, their lines were read before the
+// file was rotated and compressed. It returns the number of entries added
+// to the pos file.
+func (self *inputTail) archive(path string, startup bool) int {
+	if !self.read_archives || self.archives[path] {
+		return 0
 	}
+	self.archives[path] = true
 
-	err = t.Wait()
+	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return 0
+	}
+
+	if entry, ok := self.positions.Get(path); ok && entry.inode == inodeOf(info) {
+		return 0
+	}
+
+	if startup {
+		go self.newTailer(path).ingest(self.batches)
+		return 0
+	}
+
+	self.positions.Update(path, info.Size(), inodeOf(info))
+	return 1
+}
+
+// expandPaths returns the files matched by the paths, after expanding their
+// date placeholders such as %Y%m%d. Paths without wildcards are kept even
+// when the file does not exist yet.
+func (self *inputTail) expandPaths(now time.Time) map[string]bool {
+	paths := make(map[string]bool)
+
+	for _, pattern := range self.paths {
+		pattern = strftime(pattern, now)
+
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				log.Println("tail: invalid path", pattern, "err:", err)
+				continue
+			}
+		}
+
+		for _, path := range matches {
+			if self.excluded(path) {
+				continue
+			}
+
+			info, err := os.Stat(path)
+			if err == nil && info.IsDir() {
+				continue
+			}
+			if err == nil && self.limit_recently_modified > 0 &&
+				now.Sub(info.ModTime()) > time.Duration(self.limit_recently_modified)*time.Second {
+				continue
+			}
+
+			paths[path] = true
+		}
+	}
+
+	return paths
+}
+
+// searchTime returns the offset of the first line of the file at path whose
+// time is not before start, with a binary search which assumes the lines
+// are sorted by time. The lines without a time, e.g. the continuation lines
+// of the previous event, are skipped.
+func (self *inputTail) searchTime(path string, start time.Time) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	// lineAfter returns the start of the first line at or after offset
+	lineAfter := func(offset int64) (*bufio.Reader, int64, error) {
+		if offset == 0 {
+			return bufio.NewReader(io.NewSectionReader(f, 0, size)), 0, nil
+		}
+
+		reader := bufio.NewReader(io.NewSectionReader(f, offset-1, size-offset+1))
+		skipped, err := reader.ReadBytes('\n')
+		return reader, offset - 1 + int64(len(skipped)), err
+	}
+
+	// timedAfter returns the first line with a time at or after offset, with
+	// its start and its length, or a zero length at the end of the file
+	timedAfter := func(offset int64) (int64, int, int64, error) {
+		reader, start, err := lineAfter(offset)
+		for err == nil {
+			var line []byte
+			line, err = reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+
+			msg := Message{}
+			if self.parser.Parse(bytes.TrimSuffix(line, []byte("\n")), &msg) == nil && msg.Timestamp != 0 {
+				return start, len(line), msg.Timestamp, nil
+			}
+			start += int64(len(line))
+		}
+
+		if err == io.EOF {
+			return size, 0, 0, nil
+		}
+		return 0, 0, 0, err
+	}
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		line, length, timestamp, err := timedAfter(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if length > 0 && timestamp < start.UnixNano() {
+			lo = line + int64(length)
+		} else {
+			hi = mid
+		}
+	}
+
+	line, _, _, err := timedAfter(lo)
+	return line, err
+}
+
+func (self *inputTail) excluded(path string) bool {
+	for _, pattern := range self.exclude_paths {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// savePositions records the position of the files being read, and drops
+// the entries of the files removed or rotated since they were not read
+// anymore.
+func (self *inputTail) savePositions() error {
+	watched := make(map[string]bool)
+	for path, tailer := range self.tailers {
+		watched[path] = true
+		if tailer.inode != 0 {
+			self.positions.Update(path, tailer.offset, tailer.inode)
+		}
+	}
+	self.positions.Compact(watched)
+
+	return self.positions.Save()
+}
+
+// forward reads the file and hands its lines to the source until the tailer
+// is stopped. Once the end of the file is reached, it waits for a change of
+// the file, or polls it when it is not watched.
+func (self *fileTailer) forward(batches chan *tailBatch) {
+	defer self.reader.Close()
+
+	for {
+		batch, err := self.read(self.reader)
+		if len(batch.lines) > 0 {
+			select {
+			case batches <- batch:
+			case <-self.done:
+				return
+			}
+
+			if !self.throttle(batch.bytes) {
+				return
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+		if err != io.EOF && !os.IsNotExist(err) {
+			log.Println("tail: failed to read", self.path, "err:", err)
+		}
+		if err == io.EOF {
+			rotated, moved := self.reader.Follow()
+			if rotated != nil {
+				go self.drain(rotated, batches)
+			}
+			if moved {
+				continue
+			}
+		}
+
+		interval := tailPollInterval
+		if self.watched {
+			interval = tailWatchInterval
+		}
+
+		select {
+		case <-self.notify:
+		case <-time.After(interval):
+		case <-self.done:
+			return
+		}
+	}
+}
+
+// drain reads the lines still written to a rotated file for rotate_wait,
+// while the new file is read by forward.
+func (self *fileTailer) drain(reader *tailReader, batches chan *tailBatch) {
+	defer reader.Close()
+
+	deadline := time.Now().Add(self.rotate_wait)
+	for {
+		batch, err := self.read(reader)
+		batch.detached = true
+		if len(batch.lines) > 0 {
+			select {
+			case batches <- batch:
+			case <-self.done:
+				return
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+		if err != io.EOF || !time.Now().Before(deadline) {
+			return
+		}
+
+		select {
+		case <-time.After(tailPollInterval):
+		case <-self.done:
+			return
+		}
+	}
+}
+
+// read returns the lines read by reader until read_lines_limit lines or
+// read_bytes_limit bytes are read, or the end of the file is reached.
+func (self *fileTailer) read(reader *tailReader) (*tailBatch, error) {
+	batch := &tailBatch{tailer: self, time: time.Now()}
+
+	var err error
+	for len(batch.lines) < self.read_lines_limit {
+		var lines []string
+		lines, err = reader.Read(self.read_lines_limit - len(batch.lines))
+		for _, line := range lines {
+			batch.bytes += int64(len(line) + 1)
+		}
+		batch.lines = append(batch.lines, lines...)
+
+		if err != nil || (self.read_bytes_limit > 0 && batch.bytes >= self.read_bytes_limit) {
+			break
+		}
+	}
+
+	batch.offset, batch.inode = reader.Position()
+	return batch, err
+}
+
+// throttle counts the bytes read in the current second, and waits for the
+// next one once read_bytes_limit bytes were read. It returns false when the
+// tailer is stopped meanwhile.
+func (self *fileTailer) throttle(n int64) bool {
+	if self.read_bytes_limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(self.window) >= time.Second {
+		self.window = now
+		self.window_bytes = 0
+	}
+
+	self.window_bytes += n
+	if self.window_bytes < self.read_bytes_limit {
+		return true
+	}
+
+	select {
+	case <-time.After(self.window.Add(time.Second).Sub(now)):
+	case <-self.done:
+		return false
+	}
+
+	self.window = time.Now()
+	self.window_bytes = 0
+	return true
+}
+
+func (self *inputTail) emit(runner InputRunner, path string, text string, at time.Time) {
+	pack := <-runner.InChan()
+
+	pack.MsgBytes = []byte(text)
+	pack.Msg.Tag = self.tag
+	pack.Msg.Timestamp = at.UnixNano()
+
+	err := self.parser.Parse([]byte(text), &pack.Msg)
+	if _, ok := err.(*TypeError); ok {
+		log.Println("parser.Parse", err)
+		pack.Label = ErrorLabel
+	} else if err != nil {
+		log.Println("parser.Parse", err)
+		pack.Recycle()
+		return
+	}
+
+	if len(self.path_key) > 0 {
+		pack.Msg.Data[self.path_key] = path
 	}
 
-	return err
+	runner.RouterChan() <- pack
 }
 
 func init() {
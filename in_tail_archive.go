@@ -0,0 +1,86 @@
+package main
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// isArchive reports whether path is a compressed file, which is never
+// tailed but read once with read_archives.
+func isArchive(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".gz" || ext == ".zst"
+}
+
+func openArchive(f *os.File) (io.ReadCloser, error) {
+	if filepath.Ext(f.Name()) == ".zst" {
+		decoder, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return gzip.NewReader(f)
+}
+
+// ingest reads the lines of a compressed file once and hands them to the
+// source. The last batch is marked as archived, with the size and the inode
+// of the file as position, only once the whole file was read.
+func (self *fileTailer) ingest(batches chan *tailBatch) {
+	f, err := os.Open(self.path)
+	if err != nil {
+		log.Println("tail: failed to open", self.path, "err:", err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Println("tail: failed to open", self.path, "err:", err)
+		return
+	}
+
+	r, err := openArchive(f)
+	if err != nil {
+		log.Println("tail: failed to decompress", self.path, "err:", err)
+		return
+	}
+	defer r.Close()
+
+	reader := newArchiveReader(self.path, r)
+	reader.limit = self.line_limit
+
+	batch := &tailBatch{tailer: self, time: time.Now(), detached: true}
+	for {
+		before, _ := reader.Position()
+		lines, err := reader.Read(self.read_lines_limit - len(batch.lines))
+		after, _ := reader.Position()
+		batch.lines = append(batch.lines, lines...)
+		batch.bytes += after - before
+
+		if err == io.EOF {
+			if line, ok := reader.Rest(); ok {
+				batch.lines = append(batch.lines, line)
+			}
+			batch.archived = true
+			batch.offset, batch.inode = info.Size(), inodeOf(info)
+			batches <- batch
+			return
+		}
+		if err != nil {
+			log.Println("tail: failed to decompress", self.path, "err:", err)
+			return
+		}
+
+		if len(batch.lines) >= self.read_lines_limit {
+			batches <- batch
+			batch = &tailBatch{tailer: self, time: time.Now(), detached: true}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// unwatchedOffset marks the entries of the files fluentd stopped reading.
+const unwatchedOffset = 0xffffffffffffffff
+
+type positionEntry struct {
+	offset int64
+	inode  uint64
+}
+
+// positionFile records the position of each file read by in_tail. The
+// format is the one of fluentd, one "path\toffset\tinode" line per file with
+// offset and inode as 16 hex digits, so that either can take over the files
+// of the other.
+type positionFile struct {
+	path    string
+	entries map[string]*positionEntry
+}
+
+// loadPositionFile reads the entries of path. Files written by older
+// versions hold a bare offset, which is the position of single, or
+// "path\toffset" lines with decimal offsets. The entries fluentd marked as
+// unwatched are dropped, as well as the duplicated ones but the last.
+func loadPositionFile(path string, single string) (*positionFile, error) {
+	self := &positionFile{
+		path:    path,
+		entries: make(map[string]*positionEntry),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return self, err
+	}
+
+	if offset, err := strconv.ParseInt(string(bytes.TrimSpace(b)), 10, 64); err == nil {
+		if len(single) > 0 {
+			self.entries[single] = &positionEntry{offset: offset}
+		}
+		return self, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+
+		var offset, inode uint64
+		switch len(fields) {
+		case 2:
+			offset, err = strconv.ParseUint(fields[1], 10, 64)
+		case 3:
+			offset, err = strconv.ParseUint(fields[1], 16, 64)
+			if err == nil {
+				inode, err = strconv.ParseUint(fields[2], 16, 64)
+			}
+		default:
+			continue
+		}
+
+		if err != nil || offset == unwatchedOffset {
+			continue
+		}
+		self.entries[fields[0]] = &positionEntry{offset: int64(offset), inode: inode}
+	}
+
+	return self, scanner.Err()
+}
+
+func (self *positionFile) Get(path string) (*positionEntry, bool) {
+	entry, ok := self.entries[path]
+	return entry, ok
+}
+
+func (self *positionFile) Update(path string, offset int64, inode uint64) {
+	self.entries[path] = &positionEntry{offset: offset, inode: inode}
+}
+
+// Compact drops the entries of the files not watched anymore which were
+// removed, or replaced by another file.
+func (self *positionFile) Compact(watched map[string]bool) {
+	for path, entry := range self.entries {
+		if watched[path] {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || inodeOf(info) != entry.inode {
+			delete(self.entries, path)
+		}
+	}
+}
+
+// Save writes the entries sorted by path, and atomically replaces the
+// previous file.
+func (self *positionFile) Save() error {
+	paths := make([]string, 0, len(self.entries))
+	for path := range self.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		entry := self.entries[path]
+		fmt.Fprintf(&buf, "%s\t%016x\t%016x\n", path, entry.offset, entry.inode)
+	}
+
+	tmpPath := self.path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	f.Sync()
+	f.Close()
+
+	return os.Rename(tmpPath, self.path)
+}
+
+// ResetTailPosition makes the tail sources of config which read path read it
+// again from its head, by resetting its entry in their pos_file. It must be
+// called while gofluent is stopped, which would overwrite the pos_file.
+func ResetTailPosition(config *PipelineConfig, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	reset := 0
+	for _, input_config := range config.InputRunners {
+		cf := input_config.(map[string]string)
+		if cf["type"] != "tail" || len(cf["pos_file"]) == 0 {
+			continue
+		}
+
+		source := &inputTail{paths: splitPaths(cf["path"]), exclude_paths: splitPaths(cf["exclude_path"])}
+		if !source.expandPaths(time.Now())[path] {
+			continue
+		}
+
+		var single string
+		if len(source.paths) == 1 {
+			single = source.paths[0]
+		}
+
+		positions, err := loadPositionFile(cf["pos_file"], single)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		positions.Update(path, 0, inodeOf(info))
+		err = positions.Save()
+		if err != nil {
+			return err
+		}
+		reset++
+	}
+
+	if reset == 0 {
+		return fmt.Errorf("no tail source with a pos_file reads %s", path)
+	}
+	return nil
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPositionFile(t *testing.T) {
+	dir := "/tmp/gofluent-pos"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/a.log", []byte("hello\n"), 0600)
+	info, _ := os.Stat(dir + "/a.log")
+	inode := inodeOf(info)
+
+	Convey("Load the entries of fluentd", t, func() {
+		ioutil.WriteFile(dir+"/fluentd.pos", []byte(fmt.Sprintf(
+			"%s/a.log\t%016x\t%016x\n%s/b.log\tffffffffffffffff\t0000000000000001\n%s/a.log\t%016x\t%016x\n",
+			dir, 2, inode, dir, dir, 6, inode)), 0600)
+
+		positions, err := loadPositionFile(dir+"/fluentd.pos", "")
+		So(err, ShouldEqual, nil)
+		So(len(positions.entries), ShouldEqual, 1)
+
+		entry, ok := positions.Get(dir + "/a.log")
+		So(ok, ShouldEqual, true)
+		So(entry.offset, ShouldEqual, 6)
+		So(entry.inode, ShouldEqual, inode)
+	})
+
+	Convey("Load the entries of older versions", t, func() {
+		ioutil.WriteFile(dir+"/old.pos", []byte("/var/log/a.log\t42\n"), 0600)
+		positions, err := loadPositionFile(dir+"/old.pos", "")
+		So(err, ShouldEqual, nil)
+		entry, _ := positions.Get("/var/log/a.log")
+		So(entry.offset, ShouldEqual, 42)
+		So(entry.inode, ShouldEqual, 0)
+	})
+
+	Convey("Save replaces the file with the sorted entries", t, func() {
+		positions := &positionFile{path: dir + "/new.pos", entries: make(map[string]*positionEntry)}
+		positions.Update(dir+"/b.log", 255, 2)
+		positions.Update(dir+"/a.log", 6, inode)
+		So(positions.Save(), ShouldEqual, nil)
+
+		b, _ := ioutil.ReadFile(dir + "/new.pos")
+		So(string(b), ShouldEqual, fmt.Sprintf("%s/a.log\t%016x\t%016x\n%s/b.log\t00000000000000ff\t0000000000000002\n", dir, 6, inode, dir))
+		_, err := os.Stat(dir + "/new.pos.tmp")
+		So(os.IsNotExist(err), ShouldEqual, true)
+
+		Convey("Compact drops the unwatched entries of removed or replaced files", func() {
+			positions.Update(dir+"/c.log", 1, 3)
+			positions.Compact(map[string]bool{dir + "/c.log": true})
+			So(len(positions.entries), ShouldEqual, 2)
+			_, ok := positions.Get(dir + "/a.log")
+			So(ok, ShouldEqual, true)
+			_, ok = positions.Get(dir + "/b.log")
+			So(ok, ShouldEqual, false)
+		})
+	})
+
+	Convey("ResetTailPosition resets the entry of the sources reading the file", t, func() {
+		ioutil.WriteFile(dir+"/reset.pos", []byte(fmt.Sprintf("%s/a.log\t%016x\t%016x\n", dir, 6, inode)), 0600)
+		config := &PipelineConfig{InputRunners: []interface{}{
+			map[string]string{"type": "tail", "path": dir + "/*.log", "pos_file": dir + "/reset.pos"},
+			map[string]string{"type": "tail", "path": dir + "/other.log", "pos_file": dir + "/other.pos"},
+		}}
+
+		err := ResetTailPosition(config, dir+"/a.log")
+		So(err, ShouldEqual, nil)
+
+		positions, _ := loadPositionFile(dir+"/reset.pos", "")
+		entry, _ := positions.Get(dir + "/a.log")
+		So(entry.offset, ShouldEqual, 0)
+		So(entry.inode, ShouldEqual, inode)
+		_, err = os.Stat(dir + "/other.pos")
+		So(os.IsNotExist(err), ShouldEqual, true)
+
+		err = ResetTailPosition(config, dir+"/fluentd.pos")
+		So(err, ShouldNotEqual, nil)
+	})
+}
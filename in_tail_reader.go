@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+// lineLimit bounds the size of the lines read to max_line_size bytes. The
+// longer lines are skipped, or truncated when truncate is set.
+type lineLimit struct {
+	max_line_size int
+	truncate      bool
+}
+
+// apply returns line within the limit, or false when line is skipped.
+func (self lineLimit) apply(path string, line []byte) ([]byte, bool) {
+	if self.max_line_size <= 0 || len(line) <= self.max_line_size {
+		return line, true
+	}
+
+	if self.truncate {
+		tailMetrics.Add("truncated_lines", 1)
+		log.Println("tail: truncated a line of", len(line), "bytes in", path)
+		return line[:self.max_line_size], true
+	}
+
+	tailMetrics.Add("skipped_lines", 1)
+	log.Println("tail: skipped a line of", len(line), "bytes in", path)
+	return nil, false
+}
+
+// trimPadding removes the NUL bytes at the head of line, which are left in
+// files extended by the filesystem before their content was written, e.g.
+// after a crash.
+func trimPadding(path string, line []byte) []byte {
+	trimmed := bytes.TrimLeft(line, "\x00")
+	if n := len(line) - len(trimmed); n > 0 {
+		tailMetrics.Add("nul_bytes", int64(n))
+		log.Println("tail: skipped", n, "NUL bytes in", path)
+	}
+	return trimmed
+}
+
+// tailReader reads the lines appended to a file. It follows the file at its
+// path when it is rotated, i.e. replaced by a file with another inode, and
+// reads it again from its head when it is truncated.
+type tailReader struct {
+	path  string
+	file  *os.File
+	inode uint64
+	// offset is the end of the last complete line read
+	offset  int64
+	atEnd   bool
+	partial []byte
+	buf     []byte
+
+	limit lineLimit
+	// discarding is set while the rest of a long line is read
+	discarding bool
+	// archive is the decompressed content of a compressed file, read
+	// instead of the file
+	archive io.Reader
+}
+
+func newTailReader(path string) *tailReader {
+	return &tailReader{path: path, buf: make([]byte, 32*1024)}
+}
+
+// newArchiveReader returns a reader of the decompressed content r of the
+// compressed file at path, whose lines are bounded like the ones of the
+// tailed files.
+func newArchiveReader(path string, r io.Reader) *tailReader {
+	return &tailReader{path: path, buf: make([]byte, 32*1024), archive: r}
+}
+
+// Resume sets the position recorded for the file in the pos file. The file
+// is read from its head if it was rotated or truncated since.
+func (self *tailReader) Resume(offset int64, inode uint64) {
+	self.offset = offset
+	self.inode = inode
+}
+
+// SeekEnd makes the reader skip the content of the file when it is opened.
+func (self *tailReader) SeekEnd() {
+	self.atEnd = true
+}
+
+func (self *tailReader) open() error {
+	f, err := os.Open(self.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	inode := inodeOf(info)
+	switch {
+	case self.atEnd:
+		self.offset = info.Size()
+	case self.inode != 0 && self.inode != inode, info.Size() < self.offset:
+		self.offset = 0
+	}
+
+	_, err = f.Seek(self.offset, os.SEEK_SET)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	self.file = f
+	self.inode = inode
+	self.atEnd = false
+	self.partial = self.partial[:0]
+	self.discarding = false
+	return nil
+}
+
+// Read returns up to max complete lines of the file, without their newline.
+// It returns io.EOF once the end of the file is reached.
+func (self *tailReader) Read(max int) ([]string, error) {
+	var src io.Reader = self.archive
+	if src == nil {
+		if self.file == nil {
+			err := self.open()
+			if err != nil {
+				return nil, err
+			}
+		}
+		src = self.file
+	}
+
+	if bytes.IndexByte(self.partial, '\n') < 0 {
+		n, err := src.Read(self.buf)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		self.partial = append(self.partial, self.buf[:n]...)
+	}
+
+	var lines []string
+	data := self.partial
+	for len(lines) < max {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := data[:i]
+		self.offset += int64(i + 1)
+		data = data[i+1:]
+
+		if self.discarding {
+			self.discarding = false
+			continue
+		}
+
+		line = trimPadding(self.path, line)
+		if len(line) == 0 && i > 0 {
+			continue
+		}
+
+		line, ok := self.limit.apply(self.path, line)
+		if ok {
+			lines = append(lines, string(line))
+		}
+	}
+
+	// the padding and the long lines are not buffered until their end, the
+	// complete lines left over max are kept for the next Read
+	incomplete := bytes.IndexByte(data, '\n') < 0
+	if incomplete && len(data) > 0 && data[0] == 0 && !self.discarding {
+		trimmed := trimPadding(self.path, data)
+		self.offset += int64(len(data) - len(trimmed))
+		data = trimmed
+	}
+	if incomplete && self.limit.max_line_size > 0 && len(data) > self.limit.max_line_size {
+		if !self.discarding {
+			line, ok := self.limit.apply(self.path, data)
+			if ok {
+				lines = append(lines, string(line))
+			}
+			self.discarding = true
+		}
+		self.offset += int64(len(data))
+		data = data[:0]
+	}
+	self.partial = append(self.partial[:0], data...)
+
+	return lines, nil
+}
+
+// Rest returns the last line of a file without a newline, once Read
+// returned io.EOF. It is used for the archives, which are not appended to.
+func (self *tailReader) Rest() (string, bool) {
+	line := self.partial
+	self.offset += int64(len(line))
+	self.partial = self.partial[:0]
+
+	if self.discarding {
+		self.discarding = false
+		return "", false
+	}
+
+	line = trimPadding(self.path, line)
+	if len(line) == 0 {
+		return "", false
+	}
+
+	line, ok := self.limit.apply(self.path, line)
+	return string(line), ok
+}
+
+// Follow checks the file at path once the end of the open file is reached.
+// It reports whether the reader moved to the head of a rotated or truncated
+// file. A removed file is still read until it is replaced. When the file was
+// rotated, the reader of the rotated file is returned as well, for the lines
+// still written to it.
+func (self *tailReader) Follow() (*tailReader, bool) {
+	if self.file == nil {
+		return nil, false
+	}
+
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return nil, false
+	}
+
+	if inodeOf(info) != self.inode {
+		rotated := &tailReader{
+			path:    self.path,
+			file:    self.file,
+			inode:   self.inode,
+			offset:  self.offset,
+			partial: self.partial,
+			buf:     make([]byte, len(self.buf)),
+
+			limit:      self.limit,
+			discarding: self.discarding,
+		}
+
+		self.file = nil
+		self.offset = 0
+		self.partial = nil
+		self.discarding = false
+		return rotated, true
+	}
+
+	if info.Size() < self.offset+int64(len(self.partial)) {
+		_, err = self.file.Seek(0, os.SEEK_SET)
+		if err != nil {
+			return nil, false
+		}
+		self.offset = 0
+		self.partial = self.partial[:0]
+		self.discarding = false
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// Position returns the offset of the last complete line read and the inode
+// of the file.
+func (self *tailReader) Position() (int64, uint64) {
+	return self.offset, self.inode
+}
+
+func (self *tailReader) Close() {
+	if self.file != nil {
+		self.file.Close()
+		self.file = nil
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func tailMetric(name string) int64 {
+	if v, ok := tailMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func readAll(reader *tailReader) []string {
+	var lines []string
+	for {
+		read, err := reader.Read(1000)
+		lines = append(lines, read...)
+		if err != nil {
+			return lines
+		}
+	}
+}
+
+func TestTailReader(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	path := "/tmp/gofluent-reader.log"
+	defer os.Remove(path)
+
+	Convey("Long lines are skipped or truncated", t, func() {
+		long := strings.Repeat("x", 40*1024)
+		ioutil.WriteFile(path, []byte("short\n"+long+"\n"+long+"\nlast\n"), 0600)
+		skipped := tailMetric("skipped_lines")
+
+		reader := newTailReader(path)
+		reader.limit = lineLimit{max_line_size: 10}
+		So(readAll(reader), ShouldResemble, []string{"short", "last"})
+		So(tailMetric("skipped_lines"), ShouldEqual, skipped+2)
+
+		offset, _ := reader.Position()
+		So(offset, ShouldEqual, 6+2*(len(long)+1)+5)
+
+		truncated := tailMetric("truncated_lines")
+		reader = newTailReader(path)
+		reader.limit = lineLimit{max_line_size: 10, truncate: true}
+		So(readAll(reader), ShouldResemble, []string{"short", "xxxxxxxxxx", "xxxxxxxxxx", "last"})
+		So(tailMetric("truncated_lines"), ShouldEqual, truncated+2)
+	})
+
+	Convey("Long lines are not buffered until their end", t, func() {
+		ioutil.WriteFile(path, []byte(strings.Repeat("x", 100)), 0600)
+
+		reader := newTailReader(path)
+		reader.limit = lineLimit{max_line_size: 10}
+		lines, err := reader.Read(1000)
+		So(err, ShouldEqual, nil)
+		So(len(lines), ShouldEqual, 0)
+		So(len(reader.partial), ShouldEqual, 0)
+
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.Write([]byte("xx\nnext\n"))
+		f.Close()
+		So(readAll(reader), ShouldResemble, []string{"next"})
+	})
+
+	Convey("The lines left over max are kept with max_line_size", t, func() {
+		var content []string
+		for i := 0; i < 100; i++ {
+			content = append(content, fmt.Sprintf("line %d", i))
+		}
+		ioutil.WriteFile(path, []byte(strings.Join(content, "\n")+"\n"), 0600)
+
+		reader := newTailReader(path)
+		reader.limit = lineLimit{max_line_size: 100}
+		lines, err := reader.Read(10)
+		So(err, ShouldEqual, nil)
+		So(lines, ShouldResemble, content[:10])
+
+		offset, _ := reader.Position()
+		So(offset, ShouldEqual, len(strings.Join(content[:10], "\n"))+1)
+
+		var rest []string
+		for {
+			read, err := reader.Read(10)
+			rest = append(rest, read...)
+			if err != nil {
+				break
+			}
+		}
+		So(rest, ShouldResemble, content[10:])
+	})
+
+	Convey("The lines of archives are bounded too", t, func() {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write([]byte("short\n" + strings.Repeat("x", 1024*1024) + "\nlast"))
+		w.Close()
+
+		r, _ := gzip.NewReader(&gz)
+		reader := newArchiveReader(path, r)
+		reader.limit = lineLimit{max_line_size: 10}
+
+		var lines []string
+		buffered := 0
+		for {
+			read, err := reader.Read(1000)
+			lines = append(lines, read...)
+			if len(reader.partial) > buffered {
+				buffered = len(reader.partial)
+			}
+			if err != nil {
+				So(err, ShouldEqual, io.EOF)
+				break
+			}
+		}
+		if line, ok := reader.Rest(); ok {
+			lines = append(lines, line)
+		}
+
+		So(lines, ShouldResemble, []string{"short", "last"})
+		So(buffered, ShouldBeLessThanOrEqualTo, len(reader.buf)+10)
+	})
+
+	Convey("The NUL padding of a file is skipped", t, func() {
+		padding := tailMetric("nul_bytes")
+		ioutil.WriteFile(path, []byte("before\n\x00\x00\x00\x00after\n\x00\x00\n"), 0600)
+
+		reader := newTailReader(path)
+		So(readAll(reader), ShouldResemble, []string{"before", "after"})
+		So(tailMetric("nul_bytes"), ShouldEqual, padding+6)
+
+		ioutil.WriteFile(path, []byte(strings.Repeat("\x00", 100)), 0600)
+		reader = newTailReader(path)
+		_, err := reader.Read(1000)
+		So(err, ShouldEqual, nil)
+		_, err = reader.Read(1000)
+		So(err, ShouldEqual, io.EOF)
+		So(len(reader.partial), ShouldEqual, 0)
+		offset, _ := reader.Position()
+		So(offset, ShouldEqual, 100)
+	})
+}
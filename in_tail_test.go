@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -201,3 +207,453 @@ func TestPcreStyleRegex(t *testing.T) {
 	os.Remove(cf["pos_file"])
 	os.Remove(cf["path"])
 }
+
+func TestTailMultiline(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	cf := make(map[string]string)
+	cf["path"] = "/tmp/test.file"
+	cf["format"] = "multiline"
+	cf["format_firstline"] = "/^\\d{4}-/"
+	cf["format1"] = "/^(?<time>[^ ]*) (?<message>.*)$/"
+	cf["multiline_flush_interval"] = "1"
+	cf["tag"] = "test"
+	cf["pos_file"] = "/tmp/test.pos"
+	tail := new(inputTail)
+
+	Convey("Init tail plugin", t, func() {
+		err := tail.Init(cf)
+		So(err, ShouldEqual, nil)
+	})
+
+	rChan := make(chan *PipelinePack)
+	iRunner := NewInputRunner(NewPipelinePackPool(2), rChan)
+	os.Remove(cf["pos_file"])
+	os.Remove(cf["path"])
+
+	f, _ := os.OpenFile(cf["path"], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+
+	go tail.Run(iRunner)
+	time.Sleep(1 * time.Second)
+	f.Write([]byte("2015-01-01T00:00:00Z failed\n\tat main\n2015-01-01T00:00:01Z last\n"))
+	f.Close()
+
+	first := <-iRunner.RouterChan()
+	last := <-iRunner.RouterChan()
+
+	Convey("Lines are joined until the next first line", t, func() {
+		So(first.Msg.Data["message"], ShouldEqual, "failed\n\tat main")
+		So(first.Msg.Timestamp, ShouldEqual, time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	})
+
+	Convey("The last event is flushed", t, func() {
+		So(last.Msg.Data["message"], ShouldEqual, "last")
+	})
+
+	os.Remove(cf["pos_file"])
+	os.Remove(cf["path"])
+}
+
+func TestTailPaths(t *testing.T) {
+	dir := "/tmp/gofluent-tail"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	today := dir + "/app." + now.Format("20060102") + ".log"
+	for _, name := range []string{dir + "/a.log", dir + "/b.log", dir + "/skip.log", today} {
+		ioutil.WriteFile(name, []byte(""), 0600)
+	}
+	old := dir + "/old.log"
+	ioutil.WriteFile(old, []byte(""), 0600)
+	os.Chtimes(old, now.Add(-time.Hour), now.Add(-time.Hour))
+
+	Convey("Expand comma separated globs and date placeholders", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{
+			"path":                    dir + "/*.log, " + dir + "/app.%Y%m%d.log, " + dir + "/missing.log",
+			"exclude_path":            dir + "/skip.*",
+			"limit_recently_modified": "60",
+			"format":                  "none",
+		})
+		So(err, ShouldEqual, nil)
+
+		paths := tail.expandPaths(now)
+		So(paths, ShouldResemble, map[string]bool{
+			dir + "/a.log":       true,
+			dir + "/b.log":       true,
+			today:                true,
+			dir + "/missing.log": true,
+		})
+	})
+
+	Convey("A bare offset in pos_file is the position of the single path", t, func() {
+		ioutil.WriteFile(dir+"/legacy.pos", []byte("42"), 0600)
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{"path": dir + "/a.log", "format": "none", "pos_file": dir + "/legacy.pos"})
+		So(err, ShouldEqual, nil)
+		entry, ok := tail.positions.Get(dir + "/a.log")
+		So(ok, ShouldEqual, true)
+		So(entry.offset, ShouldEqual, 42)
+	})
+
+	Convey("New files are discovered and read from their head", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{
+			"path":             dir + "/new*.log",
+			"format":           "none",
+			"tag":              "test",
+			"path_key":         "path",
+			"refresh_interval": "1",
+			"pos_file":         dir + "/new.pos",
+			"sync_interval":    "1",
+		})
+		So(err, ShouldEqual, nil)
+
+		rChan := make(chan *PipelinePack)
+		go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+		time.Sleep(100 * time.Millisecond)
+
+		ioutil.WriteFile(dir+"/new1.log", []byte("hello\n"), 0600)
+
+		pack := <-rChan
+		So(pack.Msg.Data["message"], ShouldEqual, "hello")
+		So(pack.Msg.Data["path"], ShouldEqual, dir+"/new1.log")
+		pack.Recycle()
+
+		time.Sleep(1500 * time.Millisecond)
+		info, _ := os.Stat(dir + "/new1.log")
+		b, _ := ioutil.ReadFile(dir + "/new.pos")
+		So(string(b), ShouldEqual, fmt.Sprintf("%s/new1.log\t%016x\t%016x\n", dir, 6, inodeOf(info)))
+	})
+}
+
+func TestTailRotation(t *testing.T) {
+	dir := "/tmp/gofluent-rotate"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/app.log"
+	ioutil.WriteFile(path, []byte("skipped\n"), 0600)
+
+	tail := new(inputTail)
+	err := tail.Init(map[string]string{
+		"path":          path,
+		"format":        "none",
+		"tag":           "test",
+		"pos_file":      dir + "/app.pos",
+		"sync_interval": "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rChan := make(chan *PipelinePack)
+	go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+	time.Sleep(100 * time.Millisecond)
+
+	next := func() interface{} {
+		pack := <-rChan
+		defer pack.Recycle()
+		return pack.Msg.Data["message"]
+	}
+
+	Convey("Lines are read across rotation and truncation", t, func() {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.Write([]byte("first\n"))
+		So(next(), ShouldEqual, "first")
+
+		os.Rename(path, path+".1")
+		f.Write([]byte("last of rotated\n"))
+		f.Close()
+		ioutil.WriteFile(path, []byte("rotated\n"), 0600)
+		So(next(), ShouldEqual, "last of rotated")
+		So(next(), ShouldEqual, "rotated")
+
+		os.Truncate(path, 0)
+		time.Sleep(500 * time.Millisecond)
+		ioutil.WriteFile(path, []byte("truncated\n"), 0600)
+		So(next(), ShouldEqual, "truncated")
+	})
+
+	Convey("The pos file records the offset and inode of the file", t, func() {
+		time.Sleep(1500 * time.Millisecond)
+		info, _ := os.Stat(path)
+		positions, err := loadPositionFile(dir+"/app.pos", "")
+		So(err, ShouldEqual, nil)
+		entry, ok := positions.Get(path)
+		So(ok, ShouldEqual, true)
+		So(entry.offset, ShouldEqual, 10)
+		So(entry.inode, ShouldEqual, inodeOf(info))
+	})
+}
+
+func TestTailWatch(t *testing.T) {
+	dir := "/tmp/gofluent-watch"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/app.log"
+	ioutil.WriteFile(path, []byte(""), 0600)
+
+	Convey("Watched files are read as soon as they change", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{"path": path, "format": "none", "tag": "test"})
+		So(err, ShouldEqual, nil)
+
+		rChan := make(chan *PipelinePack)
+		go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+		time.Sleep(100 * time.Millisecond)
+
+		ioutil.WriteFile(path, []byte("hello\n"), 0600)
+
+		select {
+		case pack := <-rChan:
+			So(pack.Msg.Data["message"], ShouldEqual, "hello")
+			pack.Recycle()
+		case <-time.After(tailPollInterval - 50*time.Millisecond):
+			t.Fatal("no event before the poll interval")
+		}
+	})
+
+	Convey("Lines are read in batches of read_lines_limit", t, func() {
+		ioutil.WriteFile(path, []byte("a\nb\nc\n"), 0600)
+		tailer := &fileTailer{path: path, reader: newTailReader(path), read_lines_limit: 2}
+
+		batch, err := tailer.read(tailer.reader)
+		So(err, ShouldEqual, nil)
+		So(batch.lines, ShouldResemble, []string{"a", "b"})
+		So(batch.offset, ShouldEqual, 4)
+
+		batch, err = tailer.read(tailer.reader)
+		So(err, ShouldEqual, io.EOF)
+		So(batch.lines, ShouldResemble, []string{"c"})
+		So(batch.offset, ShouldEqual, 6)
+	})
+
+	Convey("Reading waits for the next second once read_bytes_limit_per_second is reached", t, func() {
+		tailer := &fileTailer{done: make(chan bool), read_bytes_limit: 4}
+
+		start := time.Now()
+		So(tailer.throttle(2), ShouldEqual, true)
+		So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+		So(tailer.throttle(2), ShouldEqual, true)
+		So(time.Since(start), ShouldBeGreaterThan, 900*time.Millisecond)
+	})
+}
+
+func TestTailRotateWait(t *testing.T) {
+	dir := "/tmp/gofluent-rotate-wait"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/app.log"
+	ioutil.WriteFile(path, []byte(""), 0600)
+
+	Convey("The lines written to a rotated file are read for rotate_wait", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{"path": path, "format": "none", "tag": "test", "rotate_wait": "2"})
+		So(err, ShouldEqual, nil)
+
+		rChan := make(chan *PipelinePack)
+		go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+		time.Sleep(100 * time.Millisecond)
+
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		defer f.Close()
+		os.Rename(path, path+".1")
+		ioutil.WriteFile(path, []byte("new\n"), 0600)
+
+		pack := <-rChan
+		So(pack.Msg.Data["message"], ShouldEqual, "new")
+		pack.Recycle()
+
+		f.Write([]byte("late\n"))
+		pack = <-rChan
+		So(pack.Msg.Data["message"], ShouldEqual, "late")
+		pack.Recycle()
+	})
+}
+
+func TestTailArchives(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir := "/tmp/gofluent-archives"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("gz 1\ngz 2\n"))
+	w.Close()
+	ioutil.WriteFile(dir+"/app.log.1.gz", gz.Bytes(), 0600)
+
+	var zst bytes.Buffer
+	z, _ := zstd.NewWriter(&zst)
+	z.Write([]byte("zst 1"))
+	z.Close()
+	ioutil.WriteFile(dir+"/app.log.2.zst", zst.Bytes(), 0600)
+
+	cf := map[string]string{
+		"path":          dir + "/app.log*",
+		"format":        "none",
+		"tag":           "test",
+		"pos_file":      dir + "/app.pos",
+		"sync_interval": "1",
+		"read_archives": "on",
+	}
+
+	Convey("Archives are read once at startup and recorded in the pos file", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(cf)
+		So(err, ShouldEqual, nil)
+
+		rChan := make(chan *PipelinePack)
+		go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+
+		messages := make(map[interface{}]bool)
+		for i := 0; i < 3; i++ {
+			pack := <-rChan
+			messages[pack.Msg.Data["message"]] = true
+			pack.Recycle()
+		}
+		So(messages, ShouldResemble, map[interface{}]bool{"gz 1": true, "gz 2": true, "zst 1": true})
+
+		time.Sleep(1500 * time.Millisecond)
+		positions, _ := loadPositionFile(dir+"/app.pos", "")
+		entry, ok := positions.Get(dir + "/app.log.1.gz")
+		So(ok, ShouldEqual, true)
+		So(entry.offset, ShouldEqual, gz.Len())
+		_, ok = positions.Get(dir + "/app.log.2.zst")
+		So(ok, ShouldEqual, true)
+
+		tail = new(inputTail)
+		err = tail.Init(cf)
+		So(err, ShouldEqual, nil)
+
+		rChan = make(chan *PipelinePack)
+		go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+
+		select {
+		case pack := <-rChan:
+			t.Fatal("archive read twice:", pack.Msg.Data)
+		case <-time.After(500 * time.Millisecond):
+		}
+	})
+}
+
+func TestTailStartPosition(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir := "/tmp/gofluent-start"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/app.log"
+	var content bytes.Buffer
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&content, "{\"time\":\"2015-01-01T00:00:%02dZ\",\"n\":%d}\n", i, i)
+		if i%3 == 0 {
+			content.WriteString("no time\n")
+		}
+	}
+	ioutil.WriteFile(path, content.Bytes(), 0600)
+
+	Convey("The first line not before read_from_time is found by a binary search", t, func() {
+		tail := new(inputTail)
+		err := tail.Init(map[string]string{"path": path, "format": "json", "tag": "test"})
+		So(err, ShouldEqual, nil)
+
+		for i := 0; i <= 10; i++ {
+			offset, err := tail.searchTime(path, time.Date(2015, 1, 1, 0, 0, i, 0, time.UTC))
+			So(err, ShouldEqual, nil)
+
+			b, _ := ioutil.ReadFile(path)
+			if i == 10 {
+				So(offset, ShouldEqual, len(b))
+				continue
+			}
+			So(string(b[offset:]), ShouldStartWith, fmt.Sprintf("{\"time\":\"2015-01-01T00:00:%02dZ\"", i))
+		}
+	})
+
+	Convey("Files without a position are read from read_from_time or from their head", t, func() {
+		for _, cf := range []map[string]string{
+			{"read_from_time": "2015-01-01T00:00:08Z"},
+			{"read_from_head": "on"},
+		} {
+			cf["path"] = path
+			cf["format"] = "json"
+			cf["tag"] = "test"
+			tail := new(inputTail)
+			err := tail.Init(cf)
+			So(err, ShouldEqual, nil)
+
+			rChan := make(chan *PipelinePack)
+			go tail.Run(NewInputRunner(NewPipelinePackPool(1), rChan))
+
+			pack := <-rChan
+			if len(cf["read_from_head"]) > 0 {
+				So(pack.Msg.Data["n"], ShouldEqual, 0)
+			} else {
+				So(pack.Msg.Data["n"], ShouldEqual, 8)
+			}
+			pack.Recycle()
+		}
+	})
+}
+
+// benchmarkTail writes lines in bursts, each one once the previous burst was
+// read, so that the time to notice new content counts in the throughput.
+func benchmarkTail(b *testing.B, cf map[string]string) {
+	log.SetOutput(ioutil.Discard)
+	dir, _ := ioutil.TempDir("", "gofluent-bench")
+	defer os.RemoveAll(dir)
+
+	path := dir + "/bench.log"
+	ioutil.WriteFile(path, []byte(""), 0600)
+
+	cf["path"] = path
+	cf["format"] = "none"
+	cf["tag"] = "bench"
+	tail := new(inputTail)
+	err := tail.Init(cf)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	rChan := make(chan *PipelinePack)
+	go tail.Run(NewInputRunner(NewPipelinePackPool(16), rChan))
+	time.Sleep(100 * time.Millisecond)
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	defer f.Close()
+
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i += 100 {
+		n := b.N - i
+		if n > 100 {
+			n = 100
+		}
+
+		f.Write(bytes.Repeat(line, n))
+		for j := 0; j < n; j++ {
+			pack := <-rChan
+			pack.Recycle()
+		}
+	}
+}
+
+func BenchmarkTailWatch(b *testing.B) {
+	benchmarkTail(b, map[string]string{})
+}
+
+func BenchmarkTailPoll(b *testing.B) {
+	benchmarkTail(b, map[string]string{"enable_stat_watcher": "off"})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"gopkg.in/fsnotify.v1"
+	"log"
+	"path/filepath"
+	"sync"
+)
+
+// tailWatcher wakes the tailers up when their files change, with inotify
+// watches of the directories holding the files, so that creations and
+// rotations are seen as well. The files that can not be watched, e.g. once
+// the inotify limits are exhausted, are polled by their tailers.
+type tailWatcher struct {
+	watcher *fsnotify.Watcher
+
+	mu     sync.Mutex
+	dirs   map[string]int
+	notify map[string]chan bool
+}
+
+func newTailWatcher() *tailWatcher {
+	self := &tailWatcher{
+		dirs:   make(map[string]int),
+		notify: make(map[string]chan bool),
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("tail: failed to start inotify, files are polled, err:", err)
+		return self
+	}
+	self.watcher = watcher
+
+	go self.dispatch()
+	return self
+}
+
+// Add watches path, and reports whether notify will receive its changes.
+func (self *tailWatcher) Add(path string, notify chan bool) bool {
+	if self.watcher == nil {
+		return false
+	}
+
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.dirs[dir] == 0 {
+		err := self.watcher.Add(dir)
+		if err != nil {
+			log.Println("tail: failed to watch", dir, "the files are polled, err:", err)
+			return false
+		}
+	}
+
+	self.dirs[dir]++
+	self.notify[path] = notify
+	return true
+}
+
+func (self *tailWatcher) Remove(path string) {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if _, ok := self.notify[path]; !ok {
+		return
+	}
+	delete(self.notify, path)
+
+	self.dirs[dir]--
+	if self.dirs[dir] == 0 {
+		delete(self.dirs, dir)
+		self.watcher.Remove(dir)
+	}
+}
+
+func (self *tailWatcher) dispatch() {
+	for {
+		select {
+		case event, ok := <-self.watcher.Events:
+			{
+				if !ok {
+					return
+				}
+
+				self.mu.Lock()
+				notify, ok := self.notify[filepath.Clean(event.Name)]
+				self.mu.Unlock()
+
+				if !ok {
+					continue
+				}
+
+				select {
+				case notify <- true:
+				default:
+				}
+			}
+		case err, ok := <-self.watcher.Errors:
+			{
+				if !ok {
+					return
+				}
+				log.Println("tail: inotify error:", err)
+			}
+		}
+	}
+}
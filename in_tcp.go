@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type inputTcp struct {
+	socketSource
+
+	bind                 string
+	port                 string
+	delimiter            []byte
+	message_length_limit int
+	max_connections      int
+	idle_timeout         time.Duration
+}
+
+func (self *inputTcp) Init(cf map[string]string) error {
+	self.name = "tcp"
+	self.bind = "0.0.0.0"
+	self.port = "5170"
+	self.delimiter = []byte("\n")
+	self.message_length_limit = 1024 * 1024
+
+	err := self.socketSource.init(cf)
+	if err != nil {
+		return err
+	}
+
+	value := cf["bind"]
+	if len(value) > 0 {
+		self.bind = value
+	}
+
+	value = cf["port"]
+	if len(value) > 0 {
+		self.port = value
+	}
+
+	value = cf["delimiter"]
+	if len(value) > 0 {
+		// escapes such as \r\n are allowed
+		delimiter, err := strconv.Unquote(`"` + value + `"`)
+		if err != nil {
+			return err
+		}
+		if len(delimiter) == 0 {
+			return errors.New("delimiter is empty")
+		}
+		self.delimiter = []byte(delimiter)
+	}
+
+	value = cf["message_length_limit"]
+	if len(value) > 0 {
+		message_length_limit, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.message_length_limit = message_length_limit
+	}
+
+	value = cf["max_connections"]
+	if len(value) > 0 {
+		max_connections, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.max_connections = max_connections
+	}
+
+	value = cf["idle_timeout"]
+	if len(value) > 0 {
+		idle_timeout, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.idle_timeout = time.Duration(idle_timeout) * time.Second
+	}
+
+	return nil
+}
+
+func (self *inputTcp) Run(runner InputRunner) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(self.bind, self.port))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	self.listening(listener.Addr())
+
+	var wg sync.WaitGroup
+	var slots chan bool
+	if self.max_connections > 0 {
+		slots = make(chan bool, self.max_connections)
+	}
+
+	for {
+		var conn net.Conn
+		if conn, err = listener.Accept(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Println("tcp: accept failed:", err)
+				continue
+			}
+			break
+		}
+
+		if slots != nil {
+			select {
+			case slots <- true:
+			default:
+				log.Println("tcp: max_connections reached, closing the connection of", conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+		}
+
+		wg.Add(1)
+
+		go func() {
+			self.handleConn(runner, conn, &wg)
+			if slots != nil {
+				<-slots
+			}
+		}()
+	}
+
+	wg.Wait()
+	return err
+}
+
+// handleConn reads the messages of a connection, with its own parser as the
+// connections are read concurrently.
+func (self *inputTcp) handleConn(runner InputRunner, conn net.Conn, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer conn.Close()
+
+	parser, err := NewRecordParser(self.section)
+	if err != nil {
+		log.Println("tcp: NewRecordParser", err)
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), self.message_length_limit+len(self.delimiter))
+	scanner.Split(self.split(conn.RemoteAddr()))
+
+	for {
+		if self.idle_timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(self.idle_timeout))
+		}
+
+		if !scanner.Scan() {
+			break
+		}
+		if len(scanner.Bytes()) > 0 {
+			self.emit(runner, parser, scanner.Bytes(), conn.RemoteAddr())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println("tcp: read failed, remote:", conn.RemoteAddr(), "err:", err)
+	}
+}
+
+// split returns the split function of the messages ending with delimiter.
+// The messages longer than message_length_limit are skipped, without being
+// buffered until their end.
+func (self *inputTcp) split(addr net.Addr) bufio.SplitFunc {
+	discarding := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		i := bytes.Index(data, self.delimiter)
+		if i >= 0 {
+			advance := i + len(self.delimiter)
+			if discarding {
+				discarding = false
+				return advance, nil, nil
+			}
+			if i > self.message_length_limit {
+				log.Println("tcp: skipped a message of", i, "bytes, remote:", addr)
+				return advance, nil, nil
+			}
+			return advance, data[:i], nil
+		}
+
+		if atEOF {
+			if len(data) == 0 || discarding {
+				return len(data), nil, nil
+			}
+			return len(data), data, nil
+		}
+
+		if len(data) > self.message_length_limit {
+			if !discarding {
+				log.Println("tcp: skipped a message longer than", self.message_length_limit, "bytes, remote:", addr)
+				discarding = true
+			}
+			// a delimiter may start at the end of the data
+			return len(data) - len(self.delimiter) + 1, nil, nil
+		}
+
+		return 0, nil, nil
+	}
+}
+
+func init() {
+	RegisterInput("tcp", func() interface{} {
+		return new(inputTcp)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTcpInput(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("A <parse> section is required", t, func() {
+		err := new(inputTcp).Init(map[string]string{"tag": "tcp"})
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("Messages end with the delimiter, the long ones are skipped", t, func() {
+		router, addr := startInput(t, new(inputTcp), map[string]string{
+			"tag":                  "tcp",
+			"bind":                 "127.0.0.1",
+			"port":                 "0",
+			"format":               "json",
+			"delimiter":            `\r\n`,
+			"message_length_limit": "64",
+			"source_address_key":   "addr",
+			"source_host_key":      "host",
+		}, 10)
+
+		conn, err := net.Dial("tcp", addr)
+		So(err, ShouldEqual, nil)
+
+		conn.Write([]byte(`{"n":1}` + "\r\n" + `{"n":"` + strings.Repeat("x", 100)))
+		conn.Write([]byte(strings.Repeat("x", 5000) + `"}` + "\r\n" + `{"n":2}` + "\r\n" + `{"n":`))
+		conn.Write([]byte(`3}`))
+		conn.Close()
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "tcp")
+		So(pack.Msg.Data["n"], ShouldEqual, 1)
+		So(pack.Msg.Data["addr"], ShouldEqual, "127.0.0.1")
+		So(pack.Msg.Data["host"], ShouldNotEqual, "")
+
+		pack = <-router
+		So(pack.Msg.Data["n"], ShouldEqual, 2)
+
+		pack = <-router
+		So(pack.Msg.Data["n"], ShouldEqual, 3)
+	})
+
+	Convey("Connections are parsed concurrently", t, func() {
+		router, addr := startInput(t, new(inputTcp), map[string]string{
+			"tag":    "tcp",
+			"bind":   "127.0.0.1",
+			"port":   "0",
+			"format": "json",
+		}, 10)
+
+		for i := 0; i < 2; i++ {
+			go func() {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				for j := 0; j < 20; j++ {
+					conn.Write([]byte(`{"time":"2017-01-02T03:04:05Z"}` + "\n"))
+				}
+			}()
+		}
+
+		for i := 0; i < 40; i++ {
+			pack := <-router
+			So(pack.Msg.Timestamp, ShouldEqual, int64(1483326245000000000))
+			pack.Recycle()
+		}
+	})
+
+	Convey("Connections beyond max_connections are closed", t, func() {
+		router, addr := startInput(t, new(inputTcp), map[string]string{
+			"tag":             "tcp",
+			"bind":            "127.0.0.1",
+			"port":            "0",
+			"format":          "none",
+			"max_connections": "1",
+		}, 10)
+
+		first, err := net.Dial("tcp", addr)
+		So(err, ShouldEqual, nil)
+		defer first.Close()
+
+		// the first connection is handled once its message is received
+		first.Write([]byte("hello\n"))
+		pack := <-router
+		So(pack.Msg.Data["message"], ShouldEqual, "hello")
+
+		second, err := net.Dial("tcp", addr)
+		So(err, ShouldEqual, nil)
+		defer second.Close()
+
+		second.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = second.Read(make([]byte, 1))
+		So(err, ShouldEqual, io.EOF)
+	})
+}
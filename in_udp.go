@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strconv"
+)
+
+type inputUdp struct {
+	socketSource
+
+	bind                 string
+	port                 string
+	message_length_limit int
+	receive_buffer_size  int
+	remove_newline       bool
+}
+
+func (self *inputUdp) Init(cf map[string]string) error {
+	self.name = "udp"
+	self.bind = "0.0.0.0"
+	self.port = "5160"
+	self.message_length_limit = 4096
+	self.remove_newline = true
+
+	err := self.socketSource.init(cf)
+	if err != nil {
+		return err
+	}
+
+	value := cf["bind"]
+	if len(value) > 0 {
+		self.bind = value
+	}
+
+	value = cf["port"]
+	if len(value) > 0 {
+		self.port = value
+	}
+
+	value = cf["message_length_limit"]
+	if len(value) > 0 {
+		message_length_limit, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.message_length_limit = message_length_limit
+	}
+
+	value = cf["receive_buffer_size"]
+	if len(value) > 0 {
+		receive_buffer_size, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.receive_buffer_size = receive_buffer_size
+	}
+
+	value = cf["remove_newline"]
+	if len(value) > 0 {
+		if value == "off" {
+			self.remove_newline = false
+		}
+	}
+
+	return nil
+}
+
+// Run emits each datagram as one message. The datagrams longer than
+// message_length_limit are skipped.
+func (self *inputUdp) Run(runner InputRunner) error {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(self.bind, self.port))
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	self.listening(conn.LocalAddr())
+
+	if self.receive_buffer_size > 0 {
+		err = conn.SetReadBuffer(self.receive_buffer_size)
+		if err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, self.message_length_limit+1)
+	for {
+		n, remote, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Println("udp: read failed:", err)
+				continue
+			}
+			return err
+		}
+
+		if n > self.message_length_limit {
+			log.Println("udp: skipped a message longer than", self.message_length_limit, "bytes, remote:", remote)
+			continue
+		}
+
+		text := buf[:n]
+		if self.remove_newline {
+			text = bytes.TrimRight(text, "\r\n")
+		}
+		if len(text) > 0 {
+			self.emit(runner, self.parser, text, remote)
+		}
+	}
+}
+
+func init() {
+	RegisterInput("udp", func() interface{} {
+		return new(inputUdp)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestUdpInput(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("Each datagram is a message", t, func() {
+		router, addr := startInput(t, new(inputUdp), map[string]string{
+			"tag":                  "udp",
+			"bind":                 "127.0.0.1",
+			"port":                 "0",
+			"format":               "ltsv",
+			"delimiter":            " ",
+			"label_delimiter":      "=",
+			"message_length_limit": "32",
+			"source_address_key":   "addr",
+		}, 10)
+
+		conn, err := net.Dial("udp", addr)
+		So(err, ShouldEqual, nil)
+		defer conn.Close()
+
+		conn.Write([]byte("level=info msg=started\n"))
+		conn.Write([]byte("level=debug msg=" + strings.Repeat("x", 32)))
+		conn.Write([]byte("level=warn msg=slow"))
+
+		pack := <-router
+		So(pack.Msg.Tag, ShouldEqual, "udp")
+		So(pack.Msg.Data["level"], ShouldEqual, "info")
+		So(pack.Msg.Data["msg"], ShouldEqual, "started")
+		So(pack.Msg.Data["addr"], ShouldEqual, "127.0.0.1")
+
+		pack = <-router
+		So(pack.Msg.Data["level"], ShouldEqual, "warn")
+	})
+}
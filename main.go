@@ -25,6 +25,7 @@ func main() {
 	c := flag.String("c", "gofluent.conf", "config filepath")
 	p := flag.String("p", "", "write cpu profile to file")
 	v := flag.String("v", "error.log", "log file path")
+	r := flag.String("r", "", "reset the pos_file entry of a tailed file, to read it again from its head, and exit")
 	flag.Parse()
 
 	f, err := os.OpenFile(*v, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -48,5 +49,13 @@ func main() {
 	config := NewPipeLineConfig(gc)
 	config.LoadConfig(*c)
 
+	if *r != "" {
+		err := ResetTailPosition(config, *r)
+		if err != nil {
+			log.Fatalln("reset position failed, err:", err)
+		}
+		return
+	}
+
 	Run(config)
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// multilineRule reports whether line continues the event of the previous
+// lines. state is kept between the calls, it is 0 for the first call.
+type multilineRule func(state *int, line string) bool
+
+var multilineModes = map[string]multilineRule{
+	"java":   javaContinues,
+	"python": pythonContinues,
+	"go":     goContinues,
+}
+
+var (
+	javaStackRegexp     = regexp.MustCompile(`^\s+at |^\s+\.\.\. \d+ (more|common frames omitted)$|^(Caused by|\s*Suppressed): `)
+	javaExceptionRegexp = regexp.MustCompile(`^([\w$]+\.)+[\w$]*(Exception|Error|Throwable)(: .*)?$`)
+
+	pythonChainedRegexp = regexp.MustCompile(`^(During handling of the above exception, another exception occurred:|The above exception was the direct cause of the following exception:)$`)
+
+	goStackRegexp = regexp.MustCompile(`^goroutine \d+ \[|^\t|^[\w./*()\[\]-]+\(.*\)$|^created by |^\[signal |^exit status \d+$`)
+)
+
+// javaContinues joins the exception following a log line and its stack
+// trace, including the causes.
+func javaContinues(state *int, line string) bool {
+	if javaStackRegexp.MatchString(line) {
+		*state = 1
+		return true
+	}
+	if *state == 0 && javaExceptionRegexp.MatchString(line) {
+		*state = 1
+		return true
+	}
+	*state = 0
+	return false
+}
+
+// pythonContinues joins a traceback to the log line before it. The
+// traceback ends with the first line that is not indented, the exception.
+func pythonContinues(state *int, line string) bool {
+	if line == "Traceback (most recent call last):" {
+		*state = 1
+		return true
+	}
+
+	switch *state {
+	case 1:
+		if !strings.HasPrefix(line, " ") {
+			*state = 2
+		}
+		return true
+	case 2:
+		if len(line) == 0 || pythonChainedRegexp.MatchString(line) {
+			return true
+		}
+	}
+
+	*state = 0
+	return false
+}
+
+// goContinues joins the goroutine stacks following a panic or a fatal
+// error.
+func goContinues(state *int, line string) bool {
+	if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+		*state = 1
+		return false
+	}
+
+	if *state == 1 && (len(line) == 0 || goStackRegexp.MatchString(line)) {
+		return true
+	}
+
+	*state = 0
+	return false
+}
+
+// multilineBuffer joins the lines of events spanning several lines. A line
+// starts a new event when it matches firstline, or when the rule of a
+// built-in mode does not continue the previous lines with it.
+type multilineBuffer struct {
+	firstline *regexp.Regexp
+	rule      multilineRule
+	state     int
+
+	lines   []string
+	time    time.Time
+	updated time.Time
+}
+
+// Push adds line, read at t. It returns the buffered event when line starts
+// a new one.
+func (self *multilineBuffer) Push(line string, t time.Time) (string, time.Time, bool) {
+	var first bool
+	if self.firstline != nil {
+		first = self.firstline.MatchString(line)
+	} else {
+		first = !self.rule(&self.state, line)
+	}
+
+	var event string
+	var eventTime time.Time
+	var ok bool
+	if first && len(self.lines) > 0 {
+		event, eventTime, ok = self.Flush()
+	}
+
+	if len(self.lines) == 0 {
+		self.time = t
+	}
+	self.lines = append(self.lines, line)
+	self.updated = time.Now()
+
+	return event, eventTime, ok
+}
+
+// Flush returns the buffered event, without its trailing empty lines.
+func (self *multilineBuffer) Flush() (string, time.Time, bool) {
+	if len(self.lines) == 0 {
+		return "", time.Time{}, false
+	}
+
+	event := strings.TrimRight(strings.Join(self.lines, "\n"), "\n")
+	self.lines = self.lines[:0]
+
+	return event, self.time, true
+}
+
+// Expired reports whether lines are buffered and no line was pushed for
+// timeout.
+func (self *multilineBuffer) Expired(now time.Time, timeout time.Duration) bool {
+	return len(self.lines) > 0 && now.Sub(self.updated) >= timeout
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pushLines(buffer *multilineBuffer, text string) []string {
+	var events []string
+	for _, line := range strings.Split(text, "\n") {
+		if event, _, ok := buffer.Push(line, time.Now()); ok {
+			events = append(events, event)
+		}
+	}
+	if event, _, ok := buffer.Flush(); ok {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestMultilineBuffer(t *testing.T) {
+	Convey("format_firstline starts the events", t, func() {
+		buffer := &multilineBuffer{firstline: regexp.MustCompile(`^\d{4}-`)}
+		events := pushLines(buffer, "2015-01-01 one\n  detail\n2015-01-02 two")
+		So(events, ShouldResemble, []string{"2015-01-01 one\n  detail", "2015-01-02 two"})
+	})
+
+	Convey("Java stack traces", t, func() {
+		buffer := &multilineBuffer{rule: multilineModes["java"]}
+		trace := "2015-01-01 ERROR request failed\n" +
+			"java.lang.IllegalStateException: boom\n" +
+			"\tat com.example.App.run(App.java:10)\n" +
+			"\tat com.example.App.main(App.java:5)\n" +
+			"Caused by: java.io.IOException: closed\n" +
+			"\tat com.example.Io.read(Io.java:3)\n" +
+			"\t... 2 more"
+		events := pushLines(buffer, trace+"\n2015-01-01 INFO next\n2015-01-01 INFO last")
+		So(events, ShouldResemble, []string{trace, "2015-01-01 INFO next", "2015-01-01 INFO last"})
+	})
+
+	Convey("Python tracebacks", t, func() {
+		buffer := &multilineBuffer{rule: multilineModes["python"]}
+		trace := "ERROR:root:failed\n" +
+			"Traceback (most recent call last):\n" +
+			"  File \"app.py\", line 3, in <module>\n" +
+			"    main()\n" +
+			"ValueError: bad value\n" +
+			"\n" +
+			"During handling of the above exception, another exception occurred:\n" +
+			"\n" +
+			"Traceback (most recent call last):\n" +
+			"  File \"app.py\", line 5, in <module>\n" +
+			"KeyError: 'x'"
+		events := pushLines(buffer, trace+"\nINFO:root:next")
+		So(events, ShouldResemble, []string{trace, "INFO:root:next"})
+	})
+
+	Convey("Go panics", t, func() {
+		buffer := &multilineBuffer{rule: multilineModes["go"]}
+		trace := "panic: runtime error: index out of range\n" +
+			"\n" +
+			"goroutine 1 [running]:\n" +
+			"main.(*server).handle(0xc42000e0a0)\n" +
+			"\t/go/src/app/main.go:12 +0x1d\n" +
+			"main.main()\n" +
+			"\t/go/src/app/main.go:5 +0x25\n" +
+			"exit status 2"
+		events := pushLines(buffer, "2015/01/01 starting\n"+trace+"\n2015/01/01 restarted")
+		So(events, ShouldResemble, []string{"2015/01/01 starting", trace, "2015/01/01 restarted"})
+	})
+
+	Convey("The last event expires", t, func() {
+		buffer := &multilineBuffer{firstline: regexp.MustCompile(`^\S`)}
+		now := time.Now()
+		buffer.Push("first", now)
+		So(buffer.Expired(time.Now(), time.Second), ShouldEqual, false)
+		So(buffer.Expired(time.Now().Add(time.Second), time.Second), ShouldEqual, true)
+
+		event, at, ok := buffer.Flush()
+		So(ok, ShouldEqual, true)
+		So(event, ShouldEqual, "first")
+		So(at, ShouldEqual, now)
+		So(buffer.Expired(time.Now().Add(time.Second), time.Second), ShouldEqual, false)
+	})
+
+	Convey("The multiline parser joins format1..N", t, func() {
+		record, _, err := parseLine("multiline", map[string]string{
+			"format1": `/^(?<level>[A-Z]+) /`,
+			"format2": `/(?<message>.*)/`,
+		}, "ERROR failed\n  at line 1")
+		So(err, ShouldEqual, nil)
+		So(record["level"], ShouldEqual, "ERROR")
+		So(record["message"], ShouldEqual, "failed\n  at line 1")
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"net"
 	"path/filepath"
-	"reflect"
 	"strconv"
 	"time"
 )
@@ -32,9 +31,7 @@ type OutputForward struct {
 }
 
 func (self *OutputForward) Init(config map[string]string) error {
-	_codec := codec.MsgpackHandle{}
-	_codec.MapType = reflect.TypeOf(map[string]interface{}(nil))
-	_codec.RawToString = false
+	_codec := newForwardCodec()
 	_codec.StructToArray = true
 
 	self.host = "localhost"
@@ -45,7 +42,7 @@ func (self *OutputForward) Init(config map[string]string) error {
 	self.buffer_queue_limit = 64 * 1024 * 1024
 	self.buffer_chunk_limit = 8 * 1024 * 1024
 	self.connect_timeout = 10
-	self.codec = &_codec
+	self.codec = _codec
 
 	value := config["host"]
 	if len(value) > 0 {
@@ -172,7 +169,7 @@ func (self *OutputForward) flush() error {
 }
 
 func (self *OutputForward) encodeRecordSet(msg Message) error {
-	v := []interface{}{msg.Tag, msg.Timestamp, msg.Data}
+	v := []interface{}{msg.Tag, EventTime(msg.Timestamp), msg.Data}
 	if self.enc == nil {
 		self.enc = codec.NewEncoder(&self.msg_buffer, self.codec)
 	}
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -23,6 +22,11 @@ type outputHttpsqs struct {
 	buffer         map[string][]byte
 	client         *http.Client
 	count          int
+
+	formatter    *RecordFormatter
+	content_type string
+	// json_array posts the records of a tag as one JSON array
+	json_array bool
 }
 
 func (self *outputHttpsqs) Init(f map[string]string) error {
@@ -62,6 +66,23 @@ func (self *outputHttpsqs) Init(f map[string]string) error {
 		}
 	}
 
+	section := FormatSection(f)
+	formatter, err := NewRecordFormatter(section, "json")
+	if err != nil {
+		return err
+	}
+	self.formatter = formatter
+	self.json_array = len(section["type"]) == 0 || section["type"] == "json"
+
+	switch {
+	case self.json_array:
+		self.content_type = "application/json"
+	case section["type"] == "msgpack":
+		self.content_type = "application/x-msgpack"
+	default:
+		self.content_type = "text/plain"
+	}
+
 	return nil
 }
 
@@ -79,18 +100,21 @@ func (self *outputHttpsqs) Run(runner OutputRunner) error {
 			}
 		case pack := <-runner.InChan():
 			{
-				b, err := json.Marshal(pack.Msg.Data)
+				b, err := self.formatter.Format(&pack.Msg)
 
 				if err != nil {
-					log.Println("json.Marshal:", err)
+					log.Println("formatter.Format:", err)
 					pack.Recycle()
 					continue
 				}
 
-				if len(self.buffer) == 0 {
-					self.buffer[pack.Msg.Tag] = append(self.buffer[pack.Msg.Tag], byte('['))
-				} else if len(self.buffer) > 0 {
-					self.buffer[pack.Msg.Tag] = append(self.buffer[pack.Msg.Tag], byte(','))
+				if self.json_array {
+					b = bytes.TrimRight(b, "\n")
+					if len(self.buffer[pack.Msg.Tag]) == 0 {
+						self.buffer[pack.Msg.Tag] = append(self.buffer[pack.Msg.Tag], byte('['))
+					} else {
+						self.buffer[pack.Msg.Tag] = append(self.buffer[pack.Msg.Tag], byte(','))
+					}
 				}
 
 				self.count++
@@ -105,7 +129,9 @@ func (self *outputHttpsqs) flush() {
 	for k, v := range self.buffer {
 		url := fmt.Sprintf("http://%s:%d/?name=%s&opt=put&auth=%s", self.host, self.port, k, self.auth)
 
-		v = append(v, byte(']'))
+		if self.json_array {
+			v = append(v, byte(']'))
+		}
 		var buf bytes.Buffer
 		var req *http.Request
 
@@ -119,7 +145,7 @@ func (self *outputHttpsqs) flush() {
 		}
 
 		req.Header.Add("Content-Encoding", "gzip")
-		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Content-Type", self.content_type)
 
 		log.Println("url:", url, "count:", self.count, "length:", len(v), "gziped:", buf.Len())
 
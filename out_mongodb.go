@@ -4,6 +4,7 @@ import (
 	mgo "gopkg.in/mgo.v2"
 	"log"
 	"strconv"
+	"time"
 )
 
 type outputMongo struct {
@@ -16,6 +17,9 @@ type outputMongo struct {
 	capped       bool
 	capped_size  int
 	failed_count int
+
+	include_time_key bool
+	time_key         string
 }
 
 func (this *outputMongo) Init(cf map[string]string) error {
@@ -23,6 +27,7 @@ func (this *outputMongo) Init(cf map[string]string) error {
 	this.port = "27017"
 	this.capped = false
 	this.failed_count = 0
+	this.time_key = "time"
 
 	value := cf["host"]
 	if len(value) > 0 {
@@ -66,6 +71,18 @@ func (this *outputMongo) Init(cf map[string]string) error {
 		this.capped_size, _ = strconv.Atoi(value)
 	}
 
+	value = cf["include_time_key"]
+	if len(value) > 0 {
+		if value == "on" {
+			this.include_time_key = true
+		}
+	}
+
+	value = cf["time_key"]
+	if len(value) > 0 {
+		this.time_key = value
+	}
+
 	return nil
 }
 
@@ -102,7 +119,7 @@ func (this *outputMongo) Run(runner OutputRunner) error {
 				session.Refresh()
 				coll := session.DB(this.database).C(this.collection)
 
-				err = coll.Insert(pack.Msg.Data)
+				err = coll.Insert(this.document(&pack.Msg))
 				if err != nil {
 					this.failed_count++
 					log.Println("insert failed, count=", this.failed_count, "err:", err)
@@ -116,6 +133,26 @@ func (this *outputMongo) Run(runner OutputRunner) error {
 	}
 }
 
+// document adds the event time to a copy of the record, as the record may be
+// shared with other outputs. It is stored as a BSON date, which has
+// millisecond precision, and its nanoseconds in the second are stored in
+// <time_key>_nsec.
+func (this *outputMongo) document(msg *Message) map[string]interface{} {
+	if !this.include_time_key {
+		return msg.Data
+	}
+
+	doc := make(map[string]interface{}, len(msg.Data)+2)
+	for k, v := range msg.Data {
+		doc[k] = v
+	}
+	t := time.Unix(0, msg.Timestamp)
+	doc[this.time_key] = t
+	doc[this.time_key+"_nsec"] = int64(t.Nanosecond())
+
+	return doc
+}
+
 func init() {
 	RegisterOutput("mongodb", func() interface{} {
 		return new(outputMongo)
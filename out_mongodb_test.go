@@ -9,23 +9,25 @@ import (
 
 func TestCreateAndInsert(t *testing.T) {
 	cf := map[string]string{
-		"tag":         "test",
-		"host":        "localhost",
-		"port":        "27017",
-		"database":    "test",
-		"collection":  "test",
-		"capped":      "on",
-		"capped_size": "1024",
+		"tag":              "test",
+		"host":             "localhost",
+		"port":             "27017",
+		"database":         "test",
+		"collection":       "test",
+		"capped":           "on",
+		"capped_size":      "1024",
+		"include_time_key": "on",
 	}
 	mongo := new(outputMongo)
 	mongo.Init(cf)
 	pack := new(PipelinePack)
+	pack.Msg.Timestamp = time.Date(2015, 1, 1, 0, 0, 0, 123000000, time.UTC).UnixNano()
 	pack.Msg.Data = map[string]interface{}{
 		"data":  "test",
 		"hello": "world",
 	}
 	inChan := make(chan *PipelinePack, 1)
-	oRunner := NewOutputRunner(inChan)
+	oRunner := NewOutputRunner(inChan, nil, nil)
 	inChan <- pack
 
 	go mongo.Run(oRunner)
@@ -47,11 +49,30 @@ func TestCreateAndInsert(t *testing.T) {
 		coll := session.DB(cf["database"]).C(cf["collection"])
 		So(coll, ShouldNotEqual, nil)
 
-		result := make(map[string]string)
+		result := make(map[string]interface{})
 		err1 := coll.Find(nil).One(&result)
 		So(err1, ShouldEqual, nil)
 		So(result["data"], ShouldEqual, "test")
 		So(result["hello"], ShouldEqual, "world")
+		So(result["time"].(time.Time).UnixNano(), ShouldEqual, pack.Msg.Timestamp)
+		So(result["time_nsec"], ShouldEqual, 123000000)
 		coll.DropCollection()
 	})
 }
+
+func TestMongoDocument(t *testing.T) {
+	Convey("The event time is added to a copy of the record", t, func() {
+		mongo := new(outputMongo)
+		mongo.Init(map[string]string{"include_time_key": "on", "time_key": "@timestamp"})
+
+		msg := Message{
+			Timestamp: time.Date(2015, 1, 1, 0, 0, 0, 123456789, time.UTC).UnixNano(),
+			Data:      map[string]interface{}{"data": "test"},
+		}
+		doc := mongo.document(&msg)
+		So(doc["@timestamp"].(time.Time).UnixNano(), ShouldEqual, msg.Timestamp)
+		So(doc["@timestamp_nsec"], ShouldEqual, 123456789)
+		So(doc["data"], ShouldEqual, "test")
+		So(len(msg.Data), ShouldEqual, 1)
+	})
+}
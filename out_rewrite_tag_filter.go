@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var placeholderRegexp = regexp.MustCompile(`\$\{tag\}|\$\{tag_parts\[(-?\d+)\]\}|\$(\d)`)
+
+type rewriteRule struct {
+	key     string
+	pattern *regexp.Regexp
+	tag     string
+	invert  bool
+}
+
+type outputRewriteTag struct {
+	rules        []*rewriteRule
+	match        *regexp.Regexp
+	max_rewrites int
+}
+
+func (self *outputRewriteTag) Init(cf map[string]string) error {
+	self.max_rewrites = 4
+
+	value := cf["max_rewrites"]
+	if len(value) > 0 {
+		max_rewrites, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		self.max_rewrites = max_rewrites
+	}
+
+	value = cf["tag"]
+	if len(value) > 0 {
+		chunk, err := BuildRegexpFromGlobPattern(value)
+		if err != nil {
+			return err
+		}
+		self.match = regexp.MustCompile(chunk)
+	}
+
+	for i, section := range Sections(cf, "rule") {
+		rule := new(rewriteRule)
+
+		rule.key = section["key"]
+		if len(rule.key) == 0 {
+			return fmt.Errorf("rule %d: key is required", i)
+		}
+
+		value = section["pattern"]
+		if len(value) == 0 {
+			return fmt.Errorf("rule %d: pattern is required", i)
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		rule.pattern = re
+
+		rule.tag = section["tag"]
+		if len(rule.tag) == 0 {
+			return fmt.Errorf("rule %d: tag is required", i)
+		}
+
+		if section["invert"] == "on" {
+			rule.invert = true
+		}
+
+		self.rules = append(self.rules, rule)
+	}
+
+	if len(self.rules) == 0 {
+		return errors.New("no <rule> configured")
+	}
+
+	return nil
+}
+
+func (self *outputRewriteTag) Run(runner OutputRunner) error {
+	for {
+		pack := <-runner.InChan()
+
+		tag, ok := self.rewrite(&pack.Msg)
+		if !ok {
+			pack.Recycle()
+			continue
+		}
+
+		if tag == pack.Msg.Tag || (self.match != nil && self.match.MatchString(tag)) {
+			log.Println("rewrite_tag_filter: rewritten tag would loop back, tag=", pack.Msg.Tag, "new tag=", tag)
+			pack.Recycle()
+			continue
+		}
+
+		if pack.Rewrites >= self.max_rewrites {
+			log.Println("rewrite_tag_filter: max_rewrites exceeded, tag=", pack.Msg.Tag, "new tag=", tag)
+			pack.Recycle()
+			continue
+		}
+
+		npack := <-runner.RecycleChan()
+		npack.MsgBytes = append(npack.MsgBytes[:0], pack.MsgBytes...)
+		npack.Msg.Tag = tag
+		npack.Msg.Timestamp = pack.Msg.Timestamp
+		for k, v := range pack.Msg.Data {
+			npack.Msg.Data[k] = v
+		}
+		npack.Rewrites = pack.Rewrites + 1
+		pack.Recycle()
+
+		runner.RouterChan() <- npack
+	}
+}
+
+// rewrite evaluates the rules in order and returns the tag produced by the
+// first one that matches.
+func (self *outputRewriteTag) rewrite(msg *Message) (string, bool) {
+	for _, rule := range self.rules {
+		value, ok := msg.Data[rule.key]
+		if !ok {
+			continue
+		}
+
+		str, ok := value.(string)
+		if !ok {
+			str = fmt.Sprint(value)
+		}
+
+		submatch := rule.pattern.FindStringSubmatch(str)
+		if (submatch != nil) == rule.invert {
+			continue
+		}
+
+		return expandTag(rule.tag, msg.Tag, submatch), true
+	}
+
+	return "", false
+}
+
+// expandTag replaces ${tag}, ${tag_parts[N]} and the $1..$9 backreferences
+// of the matching rule in tmpl.
+func expandTag(tmpl string, tag string, submatch []string) string {
+	parts := strings.Split(tag, ".")
+
+	return placeholderRegexp.ReplaceAllStringFunc(tmpl, func(s string) string {
+		m := placeholderRegexp.FindStringSubmatch(s)
+		switch {
+		case len(m[1]) > 0:
+			i, _ := strconv.Atoi(m[1])
+			if i < 0 {
+				i += len(parts)
+			}
+			if i < 0 || i >= len(parts) {
+				return ""
+			}
+			return parts[i]
+		case len(m[2]) > 0:
+			i, _ := strconv.Atoi(m[2])
+			if i >= len(submatch) {
+				return ""
+			}
+			return submatch[i]
+		default:
+			return tag
+		}
+	})
+}
+
+func init() {
+	RegisterOutput("rewrite_tag_filter", func() interface{} {
+		return new(outputRewriteTag)
+	})
+}
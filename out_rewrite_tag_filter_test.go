@@ -0,0 +1,82 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRewriteTag(t *testing.T) {
+	cf := map[string]string{
+		"tag":            "app.**",
+		"rule.0":         "",
+		"rule.0.key":     "level",
+		"rule.0.pattern": "^(ERROR|WARN)$",
+		"rule.0.tag":     "alert.$1.${tag_parts[1]}",
+		"rule.1":         "",
+		"rule.1.key":     "service",
+		"rule.1.pattern": "^$",
+		"rule.1.tag":     "svc.${tag}",
+		"rule.1.invert":  "on",
+		"rule.2":         "",
+		"rule.2.key":     "level",
+		"rule.2.pattern": ".*",
+		"rule.2.tag":     "app.loop",
+	}
+	rewrite := new(outputRewriteTag)
+
+	Convey("Init rewrite_tag_filter plugin", t, func() {
+		err := rewrite.Init(cf)
+		So(err, ShouldEqual, nil)
+		So(len(rewrite.rules), ShouldEqual, 3)
+	})
+
+	Convey("Rules are evaluated in order", t, func() {
+		msg := Message{Tag: "app.web", Data: map[string]interface{}{"level": "ERROR", "service": "nginx"}}
+		tag, ok := rewrite.rewrite(&msg)
+		So(ok, ShouldEqual, true)
+		So(tag, ShouldEqual, "alert.ERROR.web")
+
+		msg.Data["level"] = "INFO"
+		tag, ok = rewrite.rewrite(&msg)
+		So(ok, ShouldEqual, true)
+		So(tag, ShouldEqual, "svc.app.web")
+
+		msg.Data = map[string]interface{}{"other": 1}
+		_, ok = rewrite.rewrite(&msg)
+		So(ok, ShouldEqual, false)
+	})
+
+	in := make(chan *PipelinePack, 1)
+	router := make(chan *PipelinePack, 1)
+	oRunner := NewOutputRunner(in, NewPipelinePackPool(2), router)
+	go rewrite.Run(oRunner)
+
+	Convey("Matching events are re-emitted with the new tag", t, func() {
+		recycle := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(recycle)
+		pack.Msg.Tag = "app.web"
+		pack.Msg.Timestamp = 42
+		pack.Msg.Data["level"] = "WARN"
+		in <- pack
+
+		res := <-router
+		So(res.Msg.Tag, ShouldEqual, "alert.WARN.web")
+		So(res.Msg.Timestamp, ShouldEqual, 42)
+		So(res.Msg.Data["level"], ShouldEqual, "WARN")
+		So(res.Rewrites, ShouldEqual, 1)
+		So(len(recycle), ShouldEqual, 1)
+		res.Recycle()
+	})
+
+	Convey("Events that would loop back are dropped", t, func() {
+		recycle := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(recycle)
+		pack.Msg.Tag = "app.web"
+		pack.Msg.Data["level"] = "DEBUG"
+		pack.Msg.Data["service"] = ""
+		in <- pack
+
+		<-recycle
+		So(len(router), ShouldEqual, 0)
+	})
+}
@@ -2,12 +2,20 @@ package main
 
 import (
 	"log"
+	"os"
 )
 
 type OutputStdout struct {
+	formatter *RecordFormatter
 }
 
 func (self *OutputStdout) Init(f map[string]string) error {
+	formatter, err := NewRecordFormatter(FormatSection(f), "out_file")
+	if err != nil {
+		return err
+	}
+	self.formatter = formatter
+
 	return nil
 }
 
@@ -15,7 +23,14 @@ func (self *OutputStdout) Run(runner OutputRunner) error {
 
 	for {
 		pack := <-runner.InChan()
-		log.Println("stdout", pack.Msg)
+
+		b, err := self.formatter.Format(&pack.Msg)
+		if err != nil {
+			log.Println("stdout: format failed, tag=", pack.Msg.Tag, "err:", err)
+		} else {
+			os.Stdout.Write(b)
+		}
+
 		pack.Recycle()
 	}
 
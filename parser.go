@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+var parser_plugins = make(map[string]func() interface{})
+
+func RegisterParser(name string, parser func() interface{}) {
+	if parser == nil {
+		log.Fatalln("parser: Register parser is nil")
+	}
+
+	if _, ok := parser_plugins[name]; ok {
+		log.Fatalln("parser: Register called twice for parser " + name)
+	}
+
+	parser_plugins[name] = parser
+}
+
+// ParseSection returns the <parse> section of a plugin config. Plugins
+// without one keep configuring the parser with their own format parameter,
+// which replaces the type of the plugin in the returned copy.
+func ParseSection(cf map[string]string) map[string]string {
+	sections := Sections(cf, "parse")
+	if len(sections) > 0 {
+		return sections[0]
+	}
+	return legacySection(cf, "format")
+}
+
+func legacySection(cf map[string]string, key string) map[string]string {
+	section := make(map[string]string, len(cf))
+	for k, v := range cf {
+		section[k] = v
+	}
+	section["type"] = cf[key]
+	return section
+}
+
+// RecordParser turns text into the record and time of a message, using the
+// parser registered for the configured format. It is not safe for concurrent
+// use, the inputs reading from several goroutines create one per goroutine.
+type RecordParser struct {
+	parser        Parser
+	time_key      string
+	keep_time_key bool
+	time          *timeParser
+	types         map[string]*fieldType
+	converter     *textConverter
+}
+
+func NewRecordParser(cf map[string]string) (*RecordParser, error) {
+	self := new(RecordParser)
+
+	format := cf["type"]
+	if len(format) == 0 {
+		return nil, fmt.Errorf("no format configured")
+	}
+
+	// a format surrounded by '/' is the expression of the regexp parser
+	if strings.HasPrefix(format, "/") && strings.HasSuffix(format, "/") {
+		format = "regexp"
+	}
+
+	parser_plugin, ok := parser_plugins[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	self.parser = parser_plugin().(Parser)
+	err := self.parser.Init(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	self.converter, err = newTextConverter(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	self.time_key = "time"
+
+	value := cf["time_key"]
+	if len(value) > 0 {
+		self.time_key = value
+	}
+
+	value = cf["keep_time_key"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.keep_time_key = true
+		}
+	}
+
+	self.time, err = newTimeParser(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	value = cf["types"]
+	if len(value) > 0 {
+		self.types, err = parseTypes(value, cf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+// Parse replaces the record of msg with the one parsed from text, and its
+// timestamp with the value of time_key when the record has one. When a field
+// can not be converted to its type the record is still replaced, and a
+// *TypeError is returned. Text is first converted to encoding when
+// from_encoding or encoding are set.
+func (self *RecordParser) Parse(text []byte, msg *Message) error {
+	if self.converter != nil {
+		var err error
+		text, err = self.converter.Convert(text)
+		if err != nil {
+			return err
+		}
+	}
+
+	record, err := self.parser.Parse(text)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := record[self.time_key]; ok {
+		t, err := self.time.Parse(v)
+		if err != nil {
+			return err
+		}
+		msg.Timestamp = t.UnixNano()
+
+		if !self.keep_time_key {
+			delete(record, self.time_key)
+		}
+	}
+
+	var typeErr error
+	for k, t := range self.types {
+		v, ok := record[k]
+		if !ok {
+			continue
+		}
+		converted, ok := t.convert(v)
+		if !ok {
+			if typeErr == nil {
+				typeErr = &TypeError{Key: k, Type: t.name, Value: v}
+			}
+			continue
+		}
+		record[k] = converted
+	}
+
+	msg.Data = record
+	return typeErr
+}
@@ -0,0 +1,21 @@
+package main
+
+// Named formats for the access and error logs of common web servers, as
+// defined by fluentd.
+const (
+	apache2Expression     = `^(?<host>[^ ]*) [^ ]* (?<user>[^ ]*) \[(?<time>[^\]]*)\] "(?<method>\S+)(?: +(?<path>(?:[^\"]|\\.)*?)(?: +\S*)?)?" (?<code>[^ ]*) (?<size>[^ ]*)(?: "(?<referer>(?:[^\"]|\\.)*)" "(?<agent>(?:[^\"]|\\.)*)")?$`
+	apacheErrorExpression = `^\[[^ ]* (?<time>[^\]]*)\] \[(?:(?<module>[^:\]]+):)?(?<level>[^\]]+)\](?: \[pid (?<pid>[^\]]*)\])?(?: \[client (?<client>[^\]]*)\])? (?<message>.*)$`
+	nginxExpression       = `^(?<remote>[^ ]*) (?<host>[^ ]*) (?<user>[^ ]*) \[(?<time>[^\]]*)\] "(?<method>\S+)(?: +(?<path>[^\"]*?)(?: +\S*)?)?" (?<code>[^ ]*) (?<size>[^ ]*)(?: "(?<referer>[^\"]*)" "(?<agent>[^\"]*)"(?:\s+(?<http_x_forwarded_for>[^ ]+))?)?$`
+)
+
+func init() {
+	RegisterParser("apache2", func() interface{} {
+		return &parserRegexp{expression: apache2Expression}
+	})
+	RegisterParser("apache_error", func() interface{} {
+		return &parserRegexp{expression: apacheErrorExpression}
+	})
+	RegisterParser("nginx", func() interface{} {
+		return &parserRegexp{expression: nginxExpression}
+	})
+}
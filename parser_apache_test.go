@@ -0,0 +1,66 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func parseLine(format string, cf map[string]string, line string) (map[string]interface{}, int64, error) {
+	if cf == nil {
+		cf = make(map[string]string)
+	}
+	cf["type"] = format
+
+	parser, err := NewRecordParser(cf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msg := Message{}
+	err = parser.Parse([]byte(line), &msg)
+	return msg.Data, msg.Timestamp, err
+}
+
+func TestApacheParsers(t *testing.T) {
+	Convey("Parse an apache2 access log line", t, func() {
+		record, ts, err := parseLine("apache2", nil, `192.168.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`)
+		So(err, ShouldEqual, nil)
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["user"], ShouldEqual, "frank")
+		So(ts, ShouldEqual, time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC).UnixNano())
+		So(record["method"], ShouldEqual, "GET")
+		So(record["path"], ShouldEqual, "/apache_pb.gif")
+		So(record["code"], ShouldEqual, "200")
+		So(record["size"], ShouldEqual, "2326")
+		So(record["referer"], ShouldEqual, "http://www.example.com/start.html")
+		So(record["agent"], ShouldEqual, "Mozilla/4.08 [en] (Win98; I ;Nav)")
+	})
+
+	Convey("Parse an apache error log line", t, func() {
+		record, ts, err := parseLine("apache_error", map[string]string{"utc": "on"}, `[Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 1234] [client 127.0.0.1:5555] client denied by server configuration: /export/home/live/ap/htdocs/test`)
+		So(err, ShouldEqual, nil)
+		So(ts, ShouldEqual, time.Date(2000, 10, 11, 14, 32, 52, 123456000, time.UTC).UnixNano())
+		So(record["module"], ShouldEqual, "core")
+		So(record["level"], ShouldEqual, "error")
+		So(record["pid"], ShouldEqual, "1234")
+		So(record["client"], ShouldEqual, "127.0.0.1:5555")
+		So(record["message"], ShouldEqual, "client denied by server configuration: /export/home/live/ap/htdocs/test")
+	})
+
+	Convey("Parse an nginx access log line", t, func() {
+		record, _, err := parseLine("nginx", nil, `127.0.0.1 192.168.0.1 - [28/Feb/2013:12:00:00 +0900] "GET / HTTP/1.1" 200 777 "-" "Opera/12.0" 10.0.0.1`)
+		So(err, ShouldEqual, nil)
+		So(record["remote"], ShouldEqual, "127.0.0.1")
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["user"], ShouldEqual, "-")
+		So(record["method"], ShouldEqual, "GET")
+		So(record["path"], ShouldEqual, "/")
+		So(record["code"], ShouldEqual, "200")
+		So(record["agent"], ShouldEqual, "Opera/12.0")
+		So(record["http_x_forwarded_for"], ShouldEqual, "10.0.0.1")
+
+		_, _, err = parseLine("nginx", nil, "not an access log")
+		So(err, ShouldNotEqual, nil)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+type parserCsv struct {
+	keys      []string
+	delimiter rune
+}
+
+func (self *parserCsv) Init(cf map[string]string) error {
+	if self.delimiter == 0 {
+		self.delimiter = ','
+	}
+
+	value := cf["keys"]
+	if len(value) > 0 {
+		for _, key := range strings.Split(value, ",") {
+			self.keys = append(self.keys, strings.TrimSpace(key))
+		}
+	} else {
+		return errors.New("keys is required")
+	}
+
+	value = cf["delimiter"]
+	if len(value) > 0 {
+		if value == "\\t" {
+			value = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(value)
+		if size != len(value) {
+			return errors.New("delimiter must be a single character")
+		}
+		self.delimiter = r
+	}
+
+	return nil
+}
+
+func (self *parserCsv) Parse(text []byte) (map[string]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(text))
+	reader.Comma = self.delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	values, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(map[string]interface{})
+	for i, key := range self.keys {
+		if i < len(values) {
+			record[key] = values[i]
+		}
+	}
+
+	return record, nil
+}
+
+func init() {
+	RegisterParser("csv", func() interface{} {
+		return new(parserCsv)
+	})
+	RegisterParser("tsv", func() interface{} {
+		return &parserCsv{delimiter: '\t'}
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCsvParser(t *testing.T) {
+	Convey("Parse a CSV line with quoting", t, func() {
+		record, ts, err := parseLine("csv", map[string]string{"keys": "time,host,message", "timezone": "+09:00"}, `2013/02/28 12:00:00,192.168.0.1,"hello, ""world"""`)
+		So(err, ShouldEqual, nil)
+		So(ts, ShouldEqual, time.Date(2013, 2, 28, 3, 0, 0, 0, time.UTC).UnixNano())
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["message"], ShouldEqual, `hello, "world"`)
+	})
+
+	Convey("Parse a TSV line", t, func() {
+		record, _, err := parseLine("tsv", map[string]string{"keys": "a, b, c"}, "1\tx y\t")
+		So(err, ShouldEqual, nil)
+		So(record["a"], ShouldEqual, "1")
+		So(record["b"], ShouldEqual, "x y")
+		So(record["c"], ShouldEqual, "")
+	})
+
+	Convey("Missing values are left out", t, func() {
+		record, _, err := parseLine("csv", map[string]string{"keys": "a,b,c", "delimiter": ";"}, "1;2")
+		So(err, ShouldEqual, nil)
+		So(len(record), ShouldEqual, 2)
+	})
+
+	Convey("keys is required", t, func() {
+		_, _, err := parseLine("csv", nil, "1,2")
+		So(err, ShouldNotEqual, nil)
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"strings"
+	"unicode/utf8"
+)
+
+// textConverter converts text from from_encoding to encoding, both UTF-8 by
+// default, before it is parsed. The invalid bytes of the text are replaced
+// by replace_char, skipped, or make the conversion fail, depending on
+// invalid_bytes. The characters missing from encoding are replaced by its
+// own replacement character.
+type textConverter struct {
+	from_encoding string
+	decoder       *encoding.Decoder
+	encoder       *encoding.Encoder
+	invalid_bytes string
+	replace_char  string
+}
+
+// newTextConverter returns nil when the text needs no conversion.
+func newTextConverter(cf map[string]string) (*textConverter, error) {
+	from_encoding := cf["from_encoding"]
+	to_encoding := cf["encoding"]
+	if len(from_encoding) == 0 && len(to_encoding) == 0 {
+		return nil, nil
+	}
+
+	self := &textConverter{
+		from_encoding: "utf-8",
+		invalid_bytes: "replace",
+		replace_char:  "\uFFFD",
+	}
+
+	if len(from_encoding) > 0 && !isUTF8(from_encoding) {
+		enc, err := htmlindex.Get(from_encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unknown from_encoding %s", from_encoding)
+		}
+		self.from_encoding = from_encoding
+		self.decoder = enc.NewDecoder()
+	}
+
+	if len(to_encoding) > 0 && !isUTF8(to_encoding) {
+		enc, err := htmlindex.Get(to_encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unknown encoding %s", to_encoding)
+		}
+		self.encoder = encoding.ReplaceUnsupported(enc.NewEncoder())
+	}
+
+	value := cf["invalid_bytes"]
+	if len(value) > 0 {
+		switch value {
+		case "replace", "skip", "error":
+			self.invalid_bytes = value
+		default:
+			return nil, fmt.Errorf("invalid_bytes must be replace, skip or error")
+		}
+	}
+
+	value = cf["replace_char"]
+	if len(value) > 0 {
+		self.replace_char = value
+	}
+
+	return self, nil
+}
+
+func isUTF8(name string) bool {
+	return strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "utf8")
+}
+
+func (self *textConverter) Convert(text []byte) ([]byte, error) {
+	if self.decoder != nil {
+		var err error
+		text, err = self.decoder.Bytes(text)
+		if err != nil {
+			return nil, err
+		}
+	} else if utf8.Valid(text) {
+		return self.encode(text)
+	}
+
+	// the decoders replace the invalid bytes with U+FFFD
+	var buf bytes.Buffer
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		if r == utf8.RuneError && (size == 1 || self.decoder != nil) {
+			switch self.invalid_bytes {
+			case "replace":
+				buf.WriteString(self.replace_char)
+			case "error":
+				return nil, fmt.Errorf("invalid byte sequence in %s", self.from_encoding)
+			}
+		} else {
+			buf.Write(text[:size])
+		}
+		text = text[size:]
+	}
+
+	return self.encode(buf.Bytes())
+}
+
+func (self *textConverter) encode(text []byte) ([]byte, error) {
+	if self.encoder == nil {
+		return text, nil
+	}
+	return self.encoder.Bytes(text)
+}
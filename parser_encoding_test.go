@@ -0,0 +1,70 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func convertText(cf map[string]string, text string) (string, error) {
+	converter, err := newTextConverter(cf)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := converter.Convert([]byte(text))
+	return string(b), err
+}
+
+func TestTextConverter(t *testing.T) {
+	// 中文 in GBK
+	gbk := "\xd6\xd0\xce\xc4"
+
+	Convey("Text is converted from from_encoding to UTF-8", t, func() {
+		out, err := convertText(map[string]string{"from_encoding": "gbk"}, gbk)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "中文")
+
+		out, err = convertText(map[string]string{"from_encoding": "GB18030", "encoding": "utf-8"}, gbk)
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "中文")
+
+		_, err = newTextConverter(map[string]string{"from_encoding": "unknown"})
+		So(err, ShouldNotEqual, nil)
+
+		converter, err := newTextConverter(map[string]string{})
+		So(err, ShouldEqual, nil)
+		So(converter, ShouldEqual, nil)
+	})
+
+	Convey("Text is converted to encoding", t, func() {
+		out, err := convertText(map[string]string{"encoding": "gbk"}, "中文")
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, gbk)
+	})
+
+	Convey("Invalid bytes are handled according to invalid_bytes", t, func() {
+		out, err := convertText(map[string]string{"from_encoding": "gbk"}, "a\xffb")
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "a\uFFFDb")
+
+		out, err = convertText(map[string]string{"encoding": "utf-8", "replace_char": "?"}, "a\xffb")
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "a?b")
+
+		out, err = convertText(map[string]string{"from_encoding": "gbk", "invalid_bytes": "skip"}, "a\xffb")
+		So(err, ShouldEqual, nil)
+		So(out, ShouldEqual, "ab")
+
+		_, err = convertText(map[string]string{"encoding": "utf-8", "invalid_bytes": "error"}, "a\xffb")
+		So(err, ShouldNotEqual, nil)
+
+		_, err = newTextConverter(map[string]string{"encoding": "utf-8", "invalid_bytes": "drop"})
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("Lines are converted before they are parsed", t, func() {
+		record, _, err := parseLine("json", map[string]string{"from_encoding": "gbk"}, `{"message":"`+gbk+`"}`)
+		So(err, ShouldEqual, nil)
+		So(record["message"], ShouldEqual, "中文")
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/ugorji/go/codec"
+	"reflect"
+)
+
+type parserJson struct {
+	codec *codec.JsonHandle
+}
+
+func (self *parserJson) Init(cf map[string]string) error {
+	_codec := codec.JsonHandle{}
+	_codec.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	self.codec = &_codec
+
+	return nil
+}
+
+func (self *parserJson) Parse(text []byte) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+
+	dec := codec.NewDecoderBytes(text, self.codec)
+	err := dec.Decode(&record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func init() {
+	RegisterParser("json", func() interface{} {
+		return new(parserJson)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+)
+
+type parserLtsv struct {
+	delimiter       []byte
+	label_delimiter []byte
+}
+
+func (self *parserLtsv) Init(cf map[string]string) error {
+	self.delimiter = []byte("\t")
+	self.label_delimiter = []byte(":")
+
+	value := cf["delimiter"]
+	if len(value) > 0 {
+		self.delimiter = []byte(value)
+	}
+
+	value = cf["label_delimiter"]
+	if len(value) > 0 {
+		self.label_delimiter = []byte(value)
+	}
+
+	return nil
+}
+
+func (self *parserLtsv) Parse(text []byte) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+	for _, field := range bytes.Split(text, self.delimiter) {
+		kv := bytes.SplitN(field, self.label_delimiter, 2)
+		if len(kv) == 2 {
+			record[string(kv[0])] = string(kv[1])
+		}
+	}
+
+	return record, nil
+}
+
+func init() {
+	RegisterParser("ltsv", func() interface{} {
+		return new(parserLtsv)
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestLtsvParser(t *testing.T) {
+	Convey("Parse an LTSV line", t, func() {
+		record, ts, err := parseLine("ltsv", map[string]string{"time_format": "[%d/%b/%Y:%H:%M:%S %z]"}, "time:[28/Feb/2013:12:00:00 +0900]\thost:192.168.0.1\treq:GET /list HTTP/1.1\tstatus:200")
+		So(err, ShouldEqual, nil)
+		So(ts, ShouldEqual, time.Date(2013, 2, 28, 3, 0, 0, 0, time.UTC).UnixNano())
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["req"], ShouldEqual, "GET /list HTTP/1.1")
+		So(record["status"], ShouldEqual, "200")
+	})
+
+	Convey("Parse with custom delimiters", t, func() {
+		record, _, err := parseLine("ltsv", map[string]string{"delimiter": ",", "label_delimiter": "="}, "host=server1,url=/a?b=c")
+		So(err, ShouldEqual, nil)
+		So(record["host"], ShouldEqual, "server1")
+		So(record["url"], ShouldEqual, "/a?b=c")
+	})
+}
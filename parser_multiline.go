@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parserMultiline parses events spanning several lines, joined by in_tail,
+// with the concatenation of the format1..formatN regexps. The dot matches
+// newlines.
+type parserMultiline struct {
+	parserRegexp
+}
+
+func (self *parserMultiline) Init(cf map[string]string) error {
+	var formats []string
+	for i := 1; ; i++ {
+		value := cf["format"+strconv.Itoa(i)]
+		if len(value) == 0 {
+			break
+		}
+		formats = append(formats, strings.Trim(value, "/"))
+	}
+
+	if len(formats) == 0 {
+		return errors.New("multiline: format1 is required")
+	}
+
+	self.expression = "(?s)" + strings.Join(formats, "")
+	return self.parserRegexp.Init(cf)
+}
+
+func init() {
+	RegisterParser("multiline", func() interface{} {
+		return new(parserMultiline)
+	})
+}
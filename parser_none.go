@@ -0,0 +1,26 @@
+package main
+
+type parserNone struct {
+	message_key string
+}
+
+func (self *parserNone) Init(cf map[string]string) error {
+	self.message_key = "message"
+
+	value := cf["message_key"]
+	if len(value) > 0 {
+		self.message_key = value
+	}
+
+	return nil
+}
+
+func (self *parserNone) Parse(text []byte) (map[string]interface{}, error) {
+	return map[string]interface{}{self.message_key: string(text)}, nil
+}
+
+func init() {
+	RegisterParser("none", func() interface{} {
+		return new(parserNone)
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var pcreNamedGroupRegexp = regexp.MustCompile("\\(\\?<")
+
+type parserRegexp struct {
+	// expression is preset by the named formats built on this parser
+	expression string
+	re         *regexp.Regexp
+}
+
+func (self *parserRegexp) Init(cf map[string]string) error {
+	expression := self.expression
+	if len(expression) == 0 {
+		expression = cf["expression"]
+	}
+	if len(expression) == 0 && strings.HasPrefix(cf["format"], "/") {
+		expression = cf["format"]
+	}
+	if len(expression) == 0 {
+		return errors.New("no expression configured")
+	}
+
+	re, err := compileRegexp(expression)
+	if err != nil {
+		return err
+	}
+	self.re = re
+
+	return nil
+}
+
+// compileRegexp compiles an expression of the configuration, which may be
+// surrounded by '/'. PCRE style (?<name>...) groups are converted to Go's
+// (?P<name>...).
+func compileRegexp(expression string) (*regexp.Regexp, error) {
+	expression = strings.Trim(expression, "/")
+	expression = pcreNamedGroupRegexp.ReplaceAllString(expression, "(?P<")
+
+	return regexp.Compile(expression)
+}
+
+func (self *parserRegexp) Parse(text []byte) (map[string]interface{}, error) {
+	submatch := self.re.FindSubmatch(text)
+	if submatch == nil {
+		return nil, fmt.Errorf("pattern not matched: %q", text)
+	}
+
+	record := make(map[string]interface{})
+	for i, name := range self.re.SubexpNames() {
+		if len(name) > 0 {
+			record[name] = string(submatch[i])
+		}
+	}
+
+	return record, nil
+}
+
+func init() {
+	RegisterParser("regexp", func() interface{} {
+		return new(parserRegexp)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	rfc3164Regexp = regexp.MustCompile(`^(?:<(?P<pri>[0-9]{1,3})>)?(?P<time>[A-Z][a-z]{2} {1,2}[0-9]{1,2} [0-9]{2}:[0-9]{2}:[0-9]{2}) (?P<host>[^ ]*) (?P<ident>[^ :\[]*)(?:\[(?P<pid>[0-9]+)\])?(?:[^:]*:)? *(?P<message>.*)$`)
+	rfc5424Regexp = regexp.MustCompile(`^(?:<(?P<pri>[0-9]{1,3})>)?[1-9][0-9]{0,2} (?P<time>[^ ]+) (?P<host>[!-~]{1,255}) (?P<ident>[!-~]{1,48}) (?P<pid>[!-~]{1,128}) (?P<msgid>[!-~]{1,32}) (?P<extradata>-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (?P<message>.*))?$`)
+)
+
+type parserSyslog struct {
+	message_format string
+	with_priority  bool
+}
+
+func (self *parserSyslog) Init(cf map[string]string) error {
+	self.message_format = "rfc3164"
+
+	value := cf["message_format"]
+	if len(value) > 0 {
+		if value != "rfc3164" && value != "rfc5424" && value != "auto" {
+			return fmt.Errorf("unknown message_format %s", value)
+		}
+		self.message_format = value
+	}
+
+	value = cf["with_priority"]
+	if len(value) > 0 {
+		if value == "on" {
+			self.with_priority = true
+		}
+	}
+
+	return nil
+}
+
+func (self *parserSyslog) Parse(text []byte) (map[string]interface{}, error) {
+	re := rfc3164Regexp
+	if self.message_format == "rfc5424" {
+		re = rfc5424Regexp
+	} else if self.message_format == "auto" && isRFC5424(text) {
+		re = rfc5424Regexp
+	}
+
+	submatch := re.FindSubmatch(text)
+	if submatch == nil {
+		return nil, fmt.Errorf("pattern not matched: %q", text)
+	}
+
+	record := make(map[string]interface{})
+	for i, name := range re.SubexpNames() {
+		if len(name) == 0 || submatch[i] == nil {
+			continue
+		}
+
+		if name == "pri" {
+			pri, _ := strconv.Atoi(string(submatch[i]))
+			record[name] = pri
+		} else if name != "pid" || string(submatch[i]) != "-" {
+			record[name] = string(submatch[i])
+		}
+	}
+
+	if _, ok := record["pri"]; self.with_priority && !ok {
+		return nil, fmt.Errorf("priority not found: %q", text)
+	}
+
+	return record, nil
+}
+
+// isRFC5424 reports whether the message starts with a version number after
+// the priority, which RFC 3164 messages do not have.
+func isRFC5424(text []byte) bool {
+	i := 0
+	if len(text) > 0 && text[0] == '<' {
+		for i = 1; i < len(text) && text[i] != '>'; i++ {
+		}
+		i++
+	}
+	return i+1 < len(text) && text[i] >= '1' && text[i] <= '9' && (text[i+1] == ' ' || (text[i+1] >= '0' && text[i+1] <= '9'))
+}
+
+func init() {
+	RegisterParser("syslog", func() interface{} {
+		return new(parserSyslog)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestSyslogParser(t *testing.T) {
+	Convey("Parse an RFC 3164 message", t, func() {
+		record, ts, err := parseLine("syslog", nil, "Feb 28 12:00:00 192.168.0.1 fluentd[11111]: [error] Syslog test")
+		So(err, ShouldEqual, nil)
+		So(time.Unix(0, ts).Format("Jan _2 15:04:05"), ShouldEqual, "Feb 28 12:00:00")
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["ident"], ShouldEqual, "fluentd")
+		So(record["pid"], ShouldEqual, "11111")
+		So(record["message"], ShouldEqual, "[error] Syslog test")
+		So(record["pri"], ShouldEqual, nil)
+	})
+
+	Convey("Parse an RFC 3164 message with priority", t, func() {
+		record, ts, err := parseLine("syslog", map[string]string{"with_priority": "on"}, "<6>Feb  8 12:00:00 host sshd: Accepted publickey")
+		So(err, ShouldEqual, nil)
+		So(record["pri"], ShouldEqual, 6)
+		So(time.Unix(0, ts).Format("Jan _2 15:04:05"), ShouldEqual, "Feb  8 12:00:00")
+		So(record["ident"], ShouldEqual, "sshd")
+		So(record["message"], ShouldEqual, "Accepted publickey")
+
+		_, _, err = parseLine("syslog", map[string]string{"with_priority": "on"}, "Feb  8 12:00:00 host sshd: Accepted publickey")
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("Parse an RFC 5424 message", t, func() {
+		line := `<16>1 2013-02-28T12:00:00.003Z 192.168.0.1 fluentd 11111 ID24224 [exampleSDID@20224 iut="3" eventSource="Application" eventID="11211"] Hi, from Fluentd!`
+		record, ts, err := parseLine("syslog", map[string]string{"message_format": "rfc5424"}, line)
+		So(err, ShouldEqual, nil)
+		So(record["pri"], ShouldEqual, 16)
+		So(ts, ShouldEqual, time.Date(2013, 2, 28, 12, 0, 0, 3000000, time.UTC).UnixNano())
+		So(record["host"], ShouldEqual, "192.168.0.1")
+		So(record["ident"], ShouldEqual, "fluentd")
+		So(record["pid"], ShouldEqual, "11111")
+		So(record["msgid"], ShouldEqual, "ID24224")
+		So(record["extradata"], ShouldEqual, `[exampleSDID@20224 iut="3" eventSource="Application" eventID="11211"]`)
+		So(record["message"], ShouldEqual, "Hi, from Fluentd!")
+
+		record, _, err = parseLine("syslog", map[string]string{"message_format": "rfc5424"}, "<16>1 2013-02-28T12:00:00Z host app - - -")
+		So(err, ShouldEqual, nil)
+		So(record["pid"], ShouldEqual, nil)
+		So(record["extradata"], ShouldEqual, "-")
+	})
+
+	Convey("Detect the message format automatically", t, func() {
+		record, _, err := parseLine("syslog", map[string]string{"message_format": "auto"}, "<16>1 2013-02-28T12:00:00Z host app 42 - - auto")
+		So(err, ShouldEqual, nil)
+		So(record["pid"], ShouldEqual, "42")
+		So(record["message"], ShouldEqual, "auto")
+
+		record, _, err = parseLine("syslog", map[string]string{"message_format": "auto"}, "<16>Feb 28 12:00:00 host app: auto")
+		So(err, ShouldEqual, nil)
+		So(record["message"], ShouldEqual, "auto")
+	})
+}
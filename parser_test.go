@@ -0,0 +1,56 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRecordParser(t *testing.T) {
+	Convey("The legacy format parameter selects the parser", t, func() {
+		parser, err := NewRecordParser(ParseSection(map[string]string{
+			"type":   "tail",
+			"format": "/^(?<host>[^ ]*) (?P<path>[^ ]*)$/",
+		}))
+		So(err, ShouldEqual, nil)
+
+		msg := Message{Timestamp: 1}
+		err = parser.Parse([]byte("127.0.0.1 /index.html"), &msg)
+		So(err, ShouldEqual, nil)
+		So(msg.Timestamp, ShouldEqual, 1)
+		So(msg.Data["host"], ShouldEqual, "127.0.0.1")
+		So(msg.Data["path"], ShouldEqual, "/index.html")
+
+		err = parser.Parse([]byte("unmatched"), &msg)
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("The <parse> section configures the parser", t, func() {
+		parser, err := NewRecordParser(ParseSection(map[string]string{
+			"format":           "none",
+			"parse.0":          "",
+			"parse.0.type":     "json",
+			"parse.0.time_key": "t",
+		}))
+		So(err, ShouldEqual, nil)
+
+		msg := Message{}
+		err = parser.Parse([]byte(`{"t":1420070400,"user":"root"}`), &msg)
+		So(err, ShouldEqual, nil)
+		So(msg.Timestamp, ShouldEqual, 1420070400*int64(time.Second))
+		So(msg.Data["user"], ShouldEqual, "root")
+		So(msg.Data["t"], ShouldEqual, nil)
+	})
+
+	Convey("The none parser keeps the line as is", t, func() {
+		record, _, err := parseLine("none", map[string]string{"message_key": "log"}, "any text, even {\"json\"}")
+		So(err, ShouldEqual, nil)
+		So(record["log"], ShouldEqual, "any text, even {\"json\"}")
+		So(len(record), ShouldEqual, 1)
+	})
+
+	Convey("Unknown formats are rejected", t, func() {
+		_, err := NewRecordParser(map[string]string{"format": "unknown"})
+		So(err, ShouldNotEqual, nil)
+	})
+}
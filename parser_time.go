@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// autoTimeLayouts are tried in order when no time_format is configured. They
+// cover ISO 8601 and the time stamps of the built-in parsers. Fractional
+// seconds following the seconds field are accepted by every layout.
+var autoTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	"Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 2006",
+	"Jan _2 15:04:05",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'T': "15:04:05",
+	'F': "2006-01-02",
+	'D': "01/02/06",
+	'R': "15:04",
+	'%': "%",
+}
+
+// strftimeToLayout converts a strftime format to a Go layout. When parsing,
+// the fractional second directives %L and %N are dropped together with their
+// separator, as Go parses fractional seconds following the seconds field
+// anyway. When formatting, they become 3, 9 or the given number of digits.
+func strftimeToLayout(format string, formatting bool) (string, error) {
+	var layout []byte
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			if !formatting && (c == '.' || c == ',') && strings.HasPrefix(format[i+1:], "%") && isFractionDirective(format[i+2:]) {
+				continue
+			}
+			layout = append(layout, c)
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return "", errors.New("time_format ends with %")
+		}
+
+		if format[i] == ':' && strings.HasPrefix(format[i+1:], "z") {
+			layout = append(layout, "-07:00"...)
+			i++
+			continue
+		}
+
+		if isFractionDirective(format[i:]) {
+			digits := 0
+			for format[i] >= '0' && format[i] <= '9' {
+				digits = digits*10 + int(format[i]-'0')
+				i++
+			}
+			if digits == 0 && format[i] == 'L' {
+				digits = 3
+			} else if digits == 0 || digits > 9 {
+				digits = 9
+			}
+			if formatting {
+				layout = append(layout, strings.Repeat("0", digits)...)
+			}
+			continue
+		}
+
+		s, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported directive %%%c in time_format", format[i])
+		}
+		layout = append(layout, s...)
+	}
+
+	return string(layout), nil
+}
+
+// strftime expands the directives of format with t, leaving the rest of
+// format as it is. Unlike a layout converted by strftimeToLayout, it is safe
+// for text like paths, whose digits would be taken for layout elements.
+func strftime(format string, t time.Time) string {
+	var buf []byte
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			buf = append(buf, c)
+			continue
+		}
+
+		i++
+		if format[i] == '%' {
+			buf = append(buf, '%')
+			continue
+		}
+		layout, ok := strftimeLayouts[format[i]]
+		if !ok {
+			buf = append(buf, '%', format[i])
+			continue
+		}
+		buf = append(buf, t.Format(layout)...)
+	}
+
+	return string(buf)
+}
+
+func isFractionDirective(s string) bool {
+	s = strings.TrimLeft(s, "0123456789")
+	return strings.HasPrefix(s, "L") || strings.HasPrefix(s, "N")
+}
+
+type timeParser struct {
+	time_type string
+	layout    string
+	location  *time.Location
+
+	// last is the index of the auto layout that matched last time, shared
+	// by the goroutines parsing with the same parser
+	last int32
+}
+
+func newTimeParser(cf map[string]string) (*timeParser, error) {
+	self := &timeParser{
+		time_type: "string",
+		location:  time.Local,
+	}
+
+	value := cf["time_type"]
+	if len(value) > 0 {
+		switch value {
+		case "string", "unixtime", "float", "unixtime_millis":
+			self.time_type = value
+		default:
+			return nil, fmt.Errorf("unknown time_type %s", value)
+		}
+	}
+
+	value = cf["time_format"]
+	if len(value) > 0 {
+		if value == "%s" {
+			self.time_type = "unixtime"
+		} else if strings.Contains(value, "%") {
+			layout, err := strftimeToLayout(value, false)
+			if err != nil {
+				return nil, err
+			}
+			self.layout = layout
+		} else {
+			self.layout = value
+		}
+	}
+
+	if cf["localtime"] == "off" || cf["utc"] == "on" {
+		self.location = time.UTC
+	}
+
+	value = cf["timezone"]
+	if len(value) > 0 {
+		location, err := loadTimezone(value)
+		if err != nil {
+			return nil, err
+		}
+		self.location = location
+	}
+
+	return self, nil
+}
+
+// loadTimezone accepts both [+-]HH:MM offsets and IANA names such as
+// Asia/Shanghai.
+func loadTimezone(name string) (*time.Location, error) {
+	if t, err := time.Parse("-07:00", name); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+	if t, err := time.Parse("-0700", name); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+func (self *timeParser) Parse(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case int64:
+		return self.fromNumber(float64(v), v)
+	case uint64:
+		return self.fromNumber(float64(v), int64(v))
+	case float64:
+		return self.fromNumber(v, int64(v))
+	case []byte:
+		return self.parseString(string(v))
+	case string:
+		return self.parseString(v)
+	}
+	return time.Time{}, fmt.Errorf("invalid time %v", v)
+}
+
+func (self *timeParser) fromNumber(f float64, i int64) (time.Time, error) {
+	if self.time_type == "unixtime_millis" {
+		return time.Unix(0, i*int64(time.Millisecond)), nil
+	}
+	if self.time_type == "unixtime" || f == math.Trunc(f) {
+		return time.Unix(i, 0), nil
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+func (self *timeParser) parseString(s string) (time.Time, error) {
+	switch self.time_type {
+	case "unixtime", "unixtime_millis":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		return self.fromNumber(float64(i), i)
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		return self.fromNumber(f, int64(f))
+	}
+
+	if len(self.layout) > 0 {
+		t, err := time.ParseInLocation(self.layout, s, self.location)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return fixYear(t), nil
+	}
+
+	last := int(atomic.LoadInt32(&self.last))
+	for i := range autoTimeLayouts {
+		j := (last + i) % len(autoTimeLayouts)
+		t, err := time.ParseInLocation(autoTimeLayouts[j], s, self.location)
+		if err == nil {
+			atomic.StoreInt32(&self.last, int32(j))
+			return fixYear(t), nil
+		}
+	}
+
+	// unix seconds written as a string, e.g. by regexp captures
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return self.fromNumber(f, int64(f))
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// fixYear sets the current year on time stamps without one, such as the
+// ones of RFC 3164 syslog messages. A time stamp ending up more than a day in
+// the future is from last year.
+func fixYear(t time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+
+	now := time.Now().In(t.Location())
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
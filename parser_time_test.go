@@ -0,0 +1,89 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTimeParser(t *testing.T) {
+	parse := func(cf map[string]string, v interface{}) time.Time {
+		parser, err := newTimeParser(cf)
+		So(err, ShouldEqual, nil)
+		t, err := parser.Parse(v)
+		So(err, ShouldEqual, nil)
+		return t
+	}
+
+	Convey("strftime formats are converted to Go layouts", t, func() {
+		layout, err := strftimeToLayout("%Y-%m-%dT%H:%M:%S.%L%z", false)
+		So(err, ShouldEqual, nil)
+		So(layout, ShouldEqual, "2006-01-02T15:04:05-0700")
+
+		layout, err = strftimeToLayout("%d/%b/%Y:%H:%M:%S %:z", false)
+		So(err, ShouldEqual, nil)
+		So(layout, ShouldEqual, "02/Jan/2006:15:04:05 -07:00")
+
+		layout, err = strftimeToLayout("%Y-%m-%dT%H:%M:%S.%6N%:z", true)
+		So(err, ShouldEqual, nil)
+		So(layout, ShouldEqual, "2006-01-02T15:04:05.000000-07:00")
+
+		_, err = strftimeToLayout("%Q", false)
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("strftime only expands the directives", t, func() {
+		at := time.Date(2015, 3, 9, 0, 0, 0, 0, time.UTC)
+		So(strftime("/var/log/app-2/%Y%m%d.log", at), ShouldEqual, "/var/log/app-2/20150309.log")
+		So(strftime("100%% %Q", at), ShouldEqual, "100% %Q")
+	})
+
+	Convey("Parse with time_format", t, func() {
+		t := parse(map[string]string{"time_format": "%Y-%m-%d %H:%M:%S.%N", "utc": "on"}, "2013-02-28 12:00:00.123456789")
+		So(t.Equal(time.Date(2013, 2, 28, 12, 0, 0, 123456789, time.UTC)), ShouldEqual, true)
+
+		t = parse(map[string]string{"time_format": "2006/01/02 15:04:05", "timezone": "Asia/Shanghai"}, "2013/02/28 12:00:00")
+		So(t.Unix(), ShouldEqual, time.Date(2013, 2, 28, 4, 0, 0, 0, time.UTC).Unix())
+
+		t = parse(map[string]string{"time_format": "%s"}, "1362052800")
+		So(t.Unix(), ShouldEqual, 1362052800)
+	})
+
+	Convey("Detect ISO 8601 with fractional seconds", t, func() {
+		t := parse(nil, "2013-02-28T12:00:00.5+08:00")
+		So(t.Equal(time.Date(2013, 2, 28, 4, 0, 0, 500000000, time.UTC)), ShouldEqual, true)
+	})
+
+	Convey("Parse numeric time types", t, func() {
+		t := parse(map[string]string{"time_type": "float"}, "1362052800.25")
+		So(t.Equal(time.Unix(1362052800, 250000000)), ShouldEqual, true)
+
+		t = parse(map[string]string{"time_type": "unixtime_millis"}, int64(1362052800250))
+		So(t.Equal(time.Unix(1362052800, 250000000)), ShouldEqual, true)
+
+		t = parse(nil, float64(1362052800.5))
+		So(t.Equal(time.Unix(1362052800, 500000000)), ShouldEqual, true)
+	})
+
+	Convey("Time stamps without a year get the current one", t, func() {
+		now := time.Now()
+		t := parse(nil, now.Format("Jan _2 15:04:05"))
+		So(t.Year(), ShouldEqual, now.Year())
+	})
+
+	Convey("Invalid time is an error", t, func() {
+		parser, _ := newTimeParser(map[string]string{"time_format": "%Y-%m-%d"})
+		_, err := parser.Parse("yesterday")
+		So(err, ShouldNotEqual, nil)
+
+		_, err = newTimeParser(map[string]string{"time_type": "date"})
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("keep_time_key keeps the time field", t, func() {
+		record, ts, err := parseLine("json", map[string]string{"keep_time_key": "on"}, `{"time":"2013-02-28T12:00:00Z","a":1}`)
+		So(err, ShouldEqual, nil)
+		So(ts, ShouldEqual, time.Date(2013, 2, 28, 12, 0, 0, 0, time.UTC).UnixNano())
+		So(record["time"], ShouldEqual, "2013-02-28T12:00:00Z")
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TypeError is returned by RecordParser.Parse when a field can not be
+// converted to its configured type. The record is still parsed, the field
+// keeps its original value.
+type TypeError struct {
+	Key   string
+	Type  string
+	Value interface{}
+}
+
+func (self *TypeError) Error() string {
+	return fmt.Sprintf("can not convert %s=%v to %s", self.Key, self.Value, self.Type)
+}
+
+type fieldType struct {
+	name string
+	// delimiter of array fields
+	delimiter string
+	// time of time fields
+	time *timeParser
+}
+
+// parseTypes parses the types parameter, a comma separated list of
+// key:type[:argument], e.g. "status:integer,latency:float,tags:array:|".
+// The argument is the delimiter of an array, "," by default, or the
+// time_format of a time. The time fields share the timezone options of the
+// parser.
+func parseTypes(value string, cf map[string]string) (map[string]*fieldType, error) {
+	types := make(map[string]*fieldType)
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(field, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid types %s", field)
+		}
+
+		t := &fieldType{name: parts[1]}
+		switch t.name {
+		case "string", "integer", "float", "bool":
+		case "array":
+			t.delimiter = ","
+			if len(parts) == 3 && len(parts[2]) > 0 {
+				t.delimiter = parts[2]
+			}
+		case "time":
+			timecf := map[string]string{
+				"localtime": cf["localtime"],
+				"utc":       cf["utc"],
+				"timezone":  cf["timezone"],
+			}
+			if len(parts) == 3 {
+				timecf["time_format"] = parts[2]
+			}
+			parser, err := newTimeParser(timecf)
+			if err != nil {
+				return nil, err
+			}
+			t.time = parser
+		default:
+			return nil, fmt.Errorf("unknown type %s of %s", t.name, parts[0])
+		}
+
+		types[parts[0]] = t
+	}
+
+	return types, nil
+}
+
+// convert casts v to the type. Empty and "-" values of numeric and bool
+// fields, which logs use for missing values, become nil.
+func (self *fieldType) convert(v interface{}) (interface{}, bool) {
+	s, isString := v.(string)
+	if b, ok := v.([]byte); ok {
+		s, isString = string(b), true
+	}
+
+	switch self.name {
+	case "string":
+		if isString {
+			return s, true
+		}
+		return fmt.Sprint(v), true
+	case "integer":
+		switch v := v.(type) {
+		case int64, uint64:
+			return v, true
+		case float64:
+			return int64(v), true
+		}
+	case "float":
+		switch v := v.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		}
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, true
+		}
+	case "array":
+		if isString {
+			values := []interface{}{}
+			if len(s) == 0 {
+				return values, true
+			}
+			for _, item := range strings.Split(s, self.delimiter) {
+				values = append(values, item)
+			}
+			return values, true
+		}
+		if a, ok := v.([]interface{}); ok {
+			return a, true
+		}
+		return nil, false
+	case "time":
+		t, err := self.time.Parse(v)
+		if err != nil {
+			return nil, false
+		}
+		return t, true
+	}
+
+	if !isString {
+		return nil, false
+	}
+
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" {
+		return nil, true
+	}
+
+	switch self.name {
+	case "integer":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return i, err == nil
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	}
+
+	return nil, false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestParserTypes(t *testing.T) {
+	Convey("Parse the types parameter", t, func() {
+		types, err := parseTypes("status:integer,size:integer,latency:float,ok:bool,tags:array:,", nil)
+		So(err, ShouldEqual, nil)
+		So(len(types), ShouldEqual, 5)
+		So(types["tags"].delimiter, ShouldEqual, ",")
+
+		types, err = parseTypes("tags:array:|", nil)
+		So(err, ShouldEqual, nil)
+		So(types["tags"].delimiter, ShouldEqual, "|")
+
+		_, err = parseTypes("status:number", nil)
+		So(err, ShouldNotEqual, nil)
+
+		_, err = parseTypes("status", nil)
+		So(err, ShouldNotEqual, nil)
+	})
+
+	Convey("Regexp captures are converted", t, func() {
+		record, _, err := parseLine("regexp", map[string]string{
+			"expression": `/^(?<status>[^ ]*) (?<size>[^ ]*) (?<latency>[^ ]*) (?<ok>[^ ]*) (?<tags>[^ ]*) (?<at>[^ ]*)$/`,
+			"types":      "status:integer,size:integer,latency:float,ok:bool,tags:array:,,at:time:%Y-%m-%dT%H:%M:%S",
+			"utc":        "on",
+		}, "200 - 0.25 true a,b 2013-02-28T12:00:00")
+		So(err, ShouldEqual, nil)
+		So(record["status"], ShouldEqual, int64(200))
+		So(record["size"], ShouldEqual, nil)
+		So(record["latency"], ShouldEqual, 0.25)
+		So(record["ok"], ShouldEqual, true)
+		So(record["tags"], ShouldResemble, []interface{}{"a", "b"})
+		So(record["at"], ShouldResemble, time.Date(2013, 2, 28, 12, 0, 0, 0, time.UTC))
+	})
+
+	Convey("JSON values are converted", t, func() {
+		record, _, err := parseLine("json", map[string]string{"types": "code:string,count:integer,ratio:float"}, `{"code":404,"count":"3","ratio":1}`)
+		So(err, ShouldEqual, nil)
+		So(record["code"], ShouldEqual, "404")
+		So(record["count"], ShouldEqual, int64(3))
+		So(record["ratio"], ShouldEqual, float64(1))
+	})
+
+	Convey("A conversion error keeps the record", t, func() {
+		record, _, err := parseLine("json", map[string]string{"types": "status:integer"}, `{"status":"OK","host":"server1"}`)
+		So(err, ShouldNotEqual, nil)
+		typeErr, ok := err.(*TypeError)
+		So(ok, ShouldEqual, true)
+		So(typeErr.Key, ShouldEqual, "status")
+		So(record["status"], ShouldEqual, "OK")
+		So(record["host"], ShouldEqual, "server1")
+	})
+}
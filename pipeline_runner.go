@@ -5,8 +5,12 @@ import (
 	"sync/atomic"
 )
 
+// ErrorLabel is the label of the events plugins failed to process.
+const ErrorLabel = "@ERROR"
+
 type Message struct {
-	Tag       string
+	Tag string
+	// Timestamp is the event time in nanoseconds since the Unix epoch.
 	Timestamp int64
 	Data      map[string]interface{}
 }
@@ -16,6 +20,15 @@ type PipelinePack struct {
 	Msg         Message
 	RecycleChan chan *PipelinePack
 	RefCount    int32
+	// FilterIndex is the position in the router's filter chain from which
+	// the event still has to be filtered.
+	FilterIndex int
+	// Label routes the event to the outputs of a <label> section instead,
+	// e.g. @ERROR for the records a plugin failed to process.
+	Label string
+	// Rewrites counts how many times the event was re-emitted into the
+	// router, so that misconfigured rules cannot loop forever.
+	Rewrites int
 }
 
 func NewPipelinePack(recycleChan chan *PipelinePack) (pack *PipelinePack) {
@@ -34,6 +47,17 @@ func (this *PipelinePack) Zero() {
 	this.MsgBytes = this.MsgBytes[:cap(this.MsgBytes)]
 	this.Msg.Data = make(map[string]interface{})
 	this.RefCount = 1
+	this.FilterIndex = 0
+	this.Label = ""
+	this.Rewrites = 0
+}
+
+func NewPipelinePackPool(size int) chan *PipelinePack {
+	recycleChan := make(chan *PipelinePack, size)
+	for i := 0; i < size; i++ {
+		recycleChan <- NewPipelinePack(recycleChan)
+	}
+	return recycleChan
 }
 
 func (this *PipelinePack) Recycle() {
@@ -47,6 +71,7 @@ func (this *PipelinePack) Recycle() {
 type PipelineConfig struct {
 	Gc            *GlobalConfig
 	InputRunners  []interface{}
+	FilterRunners []interface{}
 	OutputRunners []interface{}
 	router        Router
 }
@@ -63,10 +88,24 @@ func (this *PipelineConfig) LoadConfig(path string) error {
 	configure, _ := ParseConfig(nil, path)
 	for _, v := range configure.Root.Elems {
 		if v.Name == "source" {
-			this.InputRunners = append(this.InputRunners, v.Attrs)
+			this.InputRunners = append(this.InputRunners, v.Flatten())
+		} else if v.Name == "filter" {
+			cf := v.Flatten()
+			cf["tag"] = v.Args
+			this.FilterRunners = append(this.FilterRunners, cf)
 		} else if v.Name == "match" {
-			v.Attrs["tag"] = v.Args
-			this.OutputRunners = append(this.OutputRunners, v.Attrs)
+			cf := v.Flatten()
+			cf["tag"] = v.Args
+			this.OutputRunners = append(this.OutputRunners, cf)
+		} else if v.Name == "label" {
+			for _, e := range v.Elems {
+				if e.Name == "match" {
+					cf := e.Flatten()
+					cf["tag"] = e.Args
+					cf["@label"] = v.Args
+					this.OutputRunners = append(this.OutputRunners, cf)
+				}
+			}
 		}
 	}
 
@@ -82,22 +121,34 @@ func Run(config *PipelineConfig) {
 	for _, input_config := range config.InputRunners {
 		cf := input_config.(map[string]string)
 
-		InputRecycleChan := make(chan *PipelinePack, config.Gc.PoolSize)
-		for i := 0; i < config.Gc.PoolSize; i++ {
-			iPack := NewPipelinePack(InputRecycleChan)
-			InputRecycleChan <- iPack
-		}
+		InputRecycleChan := NewPipelinePackPool(config.Gc.PoolSize)
 		iRunner := NewInputRunner(InputRecycleChan, rChan)
 
 		go iRunner.Start(cf)
 	}
 
+	for _, filter_config := range config.FilterRunners {
+		cf := filter_config.(map[string]string)
+
+		inChan := make(chan *PipelinePack, config.Gc.PoolSize)
+		FilterRecycleChan := NewPipelinePackPool(config.Gc.PoolSize)
+		fRunner := NewFilterRunner(inChan, FilterRecycleChan, rChan)
+		config.router.AddFilterChan(cf["tag"], fRunner.InChan())
+
+		go fRunner.Start(cf)
+	}
+
 	for _, output_config := range config.OutputRunners {
 		cf := output_config.(map[string]string)
 
 		inChan := make(chan *PipelinePack, config.Gc.PoolSize)
-		oRunner := NewOutputRunner(inChan)
-		config.router.AddOutChan(cf["tag"], oRunner.InChan())
+		OutputRecycleChan := NewPipelinePackPool(config.Gc.PoolSize)
+		oRunner := NewOutputRunner(inChan, OutputRecycleChan, rChan)
+		if label, ok := cf["@label"]; ok {
+			config.router.AddLabelOutChan(label, cf["tag"], oRunner.InChan())
+		} else {
+			config.router.AddOutChan(cf["tag"], oRunner.InChan())
+		}
 
 		go oRunner.Start(cf)
 	}
@@ -9,3 +9,18 @@ type Output interface {
 	Init(config map[string]string) error
 	Run(out OutputRunner) error
 }
+
+type Filter interface {
+	Init(config map[string]string) error
+	Run(f FilterRunner) error
+}
+
+type Parser interface {
+	Init(config map[string]string) error
+	Parse(text []byte) (map[string]interface{}, error)
+}
+
+type Formatter interface {
+	Init(config map[string]string) error
+	Format(msg *Message) ([]byte, error)
+}
@@ -56,16 +56,22 @@ func (this *iRunner) Start(cf map[string]string) {
 
 type OutputRunner interface {
 	InChan() chan *PipelinePack
+	RecycleChan() chan *PipelinePack
+	RouterChan() chan *PipelinePack
 	Start(cf map[string]string)
 }
 
 type oRunner struct {
-	inChan chan *PipelinePack
+	inChan      chan *PipelinePack
+	recycleChan chan *PipelinePack
+	routerChan  chan *PipelinePack
 }
 
-func NewOutputRunner(in chan *PipelinePack) OutputRunner {
+func NewOutputRunner(in, recycle, router chan *PipelinePack) OutputRunner {
 	return &oRunner{
-		inChan: in,
+		inChan:      in,
+		recycleChan: recycle,
+		routerChan:  router,
 	}
 }
 
@@ -73,6 +79,16 @@ func (this *oRunner) InChan() chan *PipelinePack {
 	return this.inChan
 }
 
+// RecycleChan is the pack pool of outputs that emit events back into the
+// router, such as rewrite_tag_filter.
+func (this *oRunner) RecycleChan() chan *PipelinePack {
+	return this.recycleChan
+}
+
+func (this *oRunner) RouterChan() chan *PipelinePack {
+	return this.routerChan
+}
+
 func (this *oRunner) Start(cf map[string]string) {
 	output_type, ok := cf["type"]
 	if !ok {
@@ -96,3 +112,63 @@ func (this *oRunner) Start(cf map[string]string) {
 		log.Fatalln("out.(Output).Run", err)
 	}
 }
+
+type FilterRunner interface {
+	InChan() chan *PipelinePack
+	RecycleChan() chan *PipelinePack
+	RouterChan() chan *PipelinePack
+	Start(cf map[string]string)
+}
+
+type fRunner struct {
+	inChan      chan *PipelinePack
+	recycleChan chan *PipelinePack
+	routerChan  chan *PipelinePack
+}
+
+func NewFilterRunner(in, recycle, router chan *PipelinePack) FilterRunner {
+	return &fRunner{
+		inChan:      in,
+		recycleChan: recycle,
+		routerChan:  router,
+	}
+}
+
+func (this *fRunner) InChan() chan *PipelinePack {
+	return this.inChan
+}
+
+// RecycleChan is the pack pool for the additional events a filter emits.
+func (this *fRunner) RecycleChan() chan *PipelinePack {
+	return this.recycleChan
+}
+
+// RouterChan takes the filtered events back to the router, which hands them
+// to the next matching filter or to the outputs.
+func (this *fRunner) RouterChan() chan *PipelinePack {
+	return this.routerChan
+}
+
+func (this *fRunner) Start(cf map[string]string) {
+	filter_type, ok := cf["type"]
+	if !ok {
+		log.Fatalln("no type configured")
+	}
+
+	filter_plugin, ok := filter_plugins[filter_type]
+	if !ok {
+		log.Fatalln("unkown type ", filter_type)
+	}
+
+	filter := filter_plugin()
+
+	err := filter.(Filter).Init(cf)
+	if err != nil {
+		log.Fatalln("filter.(Filter).Init", err)
+	}
+
+	err = filter.(Filter).Run(this)
+	if err != nil {
+		log.Fatalln("filter.(Filter).Run", err)
+	}
+}
@@ -6,13 +6,23 @@ import (
 	"sync/atomic"
 )
 
+type filterChan struct {
+	re     *regexp.Regexp
+	inChan chan *PipelinePack
+}
+
 type Router struct {
 	inChan  chan *PipelinePack
+	filters []filterChan
 	outChan map[*regexp.Regexp]chan *PipelinePack
+	// labels holds the outputs of the <label> sections, which only receive
+	// the events emitted to that label, such as @ERROR.
+	labels map[string]map[*regexp.Regexp]chan *PipelinePack
 }
 
 func (self *Router) Init() {
 	self.outChan = make(map[*regexp.Regexp]chan *PipelinePack)
+	self.labels = make(map[string]map[*regexp.Regexp]chan *PipelinePack)
 }
 
 func (self *Router) AddOutChan(matchtag string, outChan chan *PipelinePack) error {
@@ -30,14 +40,55 @@ func (self *Router) AddOutChan(matchtag string, outChan chan *PipelinePack) erro
 	return nil
 }
 
+func (self *Router) AddLabelOutChan(label string, matchtag string, outChan chan *PipelinePack) error {
+	chunk, err := BuildRegexpFromGlobPattern(matchtag)
+	if err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile(chunk)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := self.labels[label]; !ok {
+		self.labels[label] = make(map[*regexp.Regexp]chan *PipelinePack)
+	}
+	self.labels[label][re] = outChan
+	return nil
+}
+
+// AddFilterChan appends a filter stage. Filters are applied in the order
+// they were added, before the event is dispatched to the outputs.
+func (self *Router) AddFilterChan(matchtag string, inChan chan *PipelinePack) error {
+	chunk, err := BuildRegexpFromGlobPattern(matchtag)
+	if err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile(chunk)
+	if err != nil {
+		return err
+	}
+
+	self.filters = append(self.filters, filterChan{re, inChan})
+	return nil
+}
+
 func (self *Router) AddInChan(inChan chan *PipelinePack) {
 	self.inChan = inChan
 }
 
 func (self *Router) Loop() {
 	for pack := range self.inChan {
+		outChans := self.outChan
+		if len(pack.Label) > 0 {
+			outChans = self.labels[pack.Label]
+		} else if self.filter(pack) {
+			continue
+		}
 
-		for re, outChan := range self.outChan {
+		for re, outChan := range outChans {
 			flag := re.MatchString(pack.Msg.Tag)
 			if flag == true {
 				atomic.AddInt32(&pack.RefCount, 1)
@@ -56,3 +107,26 @@ func (self *Router) Loop() {
 		pack.Recycle()
 	}
 }
+
+// filter hands the pack over to the next filter matching its tag. The filter
+// owns the pack until it sends it back through its RouterChan.
+func (self *Router) filter(pack *PipelinePack) bool {
+	for i := pack.FilterIndex; i < len(self.filters); i++ {
+		filter := self.filters[i]
+		if !filter.re.MatchString(pack.Msg.Tag) {
+			continue
+		}
+
+		pack.FilterIndex = i + 1
+		select {
+		case filter.inChan <- pack:
+		default:
+			log.Println("filter inChan fulled, tag=", pack.Msg.Tag)
+			(<-filter.inChan).Recycle()
+			filter.inChan <- pack
+		}
+		return true
+	}
+
+	return false
+}
@@ -91,3 +91,59 @@ func TestRouter(t *testing.T) {
 
 	})
 }
+
+func TestRouterFilter(t *testing.T) {
+	in := make(chan *PipelinePack)
+	filter := make(chan *PipelinePack, 1)
+	out := make(chan *PipelinePack, 1)
+	router := new(Router)
+
+	router.Init()
+	router.AddInChan(in)
+	router.AddFilterChan("test.**", filter)
+	router.AddOutChan("test.**", out)
+	go router.Loop()
+
+	Convey("Events pass the filters before reaching the outputs", t, func() {
+		one := NewPipelinePack(in)
+		one.Msg.Tag = "test.one"
+		in <- one
+
+		res := <-filter
+		So(res.Msg.Tag, ShouldEqual, "test.one")
+		So(res.FilterIndex, ShouldEqual, 1)
+		So(len(out), ShouldEqual, 0)
+
+		// send it back as a filter does
+		in <- res
+		res = <-out
+		So(res.Msg.Tag, ShouldEqual, "test.one")
+	})
+}
+
+func TestRouterLabel(t *testing.T) {
+	in := make(chan *PipelinePack)
+	filter := make(chan *PipelinePack, 1)
+	out := make(chan *PipelinePack, 1)
+	errOut := make(chan *PipelinePack, 1)
+	router := new(Router)
+
+	router.Init()
+	router.AddInChan(in)
+	router.AddFilterChan("**", filter)
+	router.AddOutChan("**", out)
+	router.AddLabelOutChan(ErrorLabel, "**", errOut)
+	go router.Loop()
+
+	Convey("Labeled events skip the filters and the default outputs", t, func() {
+		one := NewPipelinePack(in)
+		one.Msg.Tag = "test.one"
+		one.Label = ErrorLabel
+		in <- one
+
+		res := <-errOut
+		So(res.Msg.Tag, ShouldEqual, "test.one")
+		So(len(filter), ShouldEqual, 0)
+		So(len(out), ShouldEqual, 0)
+	})
+}